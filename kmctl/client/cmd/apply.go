@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"log"
+	"strings"
 	"sync"
 
 	"github.com/spf13/cobra"
@@ -10,18 +12,80 @@ import (
 	"com.kubebackend/m/client/model"
 )
 
-var yamlPath string
+var (
+	yamlPath     string
+	kustomizeDir string
+	renderOnly   bool
+	templated    bool
+	resolveArch  bool
+	imageMapPath string
+	prune        bool
+	selector     string
+	applySetName string
+	pruneKinds   []string
+	dryRun       bool
+)
 
 // applyCmd represents the apply command
 var applyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply kubernetes yaml file to the all clusters",
 	Long: `Apply kubernetes yaml file to the all clusters.
+
+	-k renders a kustomization directory for each cluster and applies every
+	object in it. A cluster uses <dir>/overlays/<name> when it exists, then
+	<dir>/overlays/<group> for its group in the config, then <dir> itself,
+	else <dir>/base.
+
+	With --template the manifest is a Go template executed per cluster with
+	{{ .Name }}, {{ .Group }}, {{ .Context }} and the vars of the cluster and its
+	group, e.g. {{ .Vars.robot_id }}. Without it the manifest is sent as written.
+	--render-only prints the manifests instead of applying them.
+
+	--resolve-arch sets each container's image to the one built for the
+	architecture of the cluster's nodes, from the container's annotation
+	images.kube-backend/<container>: "arm64=<image>,amd64=<image>" or from
+	--image-map (which implies --resolve-arch). A cluster is skipped when a
+	declared container has no image for one of its architectures.
+
+	--prune -l <selector> labels the applied objects with an apply set of the
+	selector, then deletes the objects of that apply set which the manifest no
+	longer has, in the manifest's namespaces and those the apply set used
+	before. Every object must match the selector. The apply set is named by
+	--apply-set, by default the yaml file or overlay, so manifests sharing a
+	selector do not prune each other. Only --prune-allowlist kinds are pruned (default Deployment,
+	Service). --dry-run lists what would be pruned without applying anything.
 	
 	For example:
-	apply -f <yaml-file-path>`,
+	apply -f <yaml-file-path>
+	apply -k <kustomization-dir>
+	apply -f <yaml-file-path> --template --render-only
+	apply -f <yaml-file-path> --image-map <image-map-file>
+	apply -k <kustomization-dir> --prune -l app.kubernetes.io/part-of=robot-stack --dry-run`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("Apply: %s\n", yamlPath)
+		source := yamlPath
+		if kustomizeDir != "" {
+			source = kustomizeDir
+		}
+		images, err := loadImageMap()
+		if err != nil {
+			log.Printf("Failed to load image map: %v\n", err)
+			return
+		}
+		if renderOnly {
+			renderManifests(cmd, source, kustomizeDir != "", images)
+			return
+		}
+
+		var pruneOptions *controller.Prune
+		if prune {
+			pruneOptions = &controller.Prune{ApplySet: applySetName, Selector: selector, Kinds: pruneKinds, DryRun: dryRun}
+		} else if dryRun {
+			log.Printf("--dry-run previews a prune and needs --prune\n")
+			return
+		}
+
+		fmt.Printf("Apply: %s\n", source)
 		fmt.Println()
 
 		var wg sync.WaitGroup
@@ -29,8 +93,18 @@ var applyCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				yamlCon := controller.NewYaml(&cluster.Host, &cluster.Port)
-				yamlCon.ApplyYaml(&yamlPath, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				yamlCon, err := controller.NewYaml(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				if kustomizeDir != "" {
+					yamlCon.ApplyKustomize(ctx, &kustomizeDir, templated, images, pruneOptions, &cluster)
+				} else {
+					yamlCon.ApplyYaml(ctx, &yamlPath, templated, images, pruneOptions, &cluster)
+				}
 				fmt.Println()
 			}(cluster)
 		}
@@ -38,7 +112,60 @@ var applyCmd = &cobra.Command{
 	},
 }
 
+// loadImageMap returns the image map of --image-map, an empty one for
+// --resolve-arch alone, or nil when images are applied as written.
+func loadImageMap() (*controller.ImageMap, error) {
+	if imageMapPath != "" {
+		return controller.LoadImageMap(imageMapPath)
+	}
+	if resolveArch {
+		return &controller.ImageMap{}, nil
+	}
+	return nil, nil
+}
+
+// renderManifests prints the manifest rendered for each cluster as one yaml
+// stream, in config order.
+func renderManifests(cmd *cobra.Command, path string, kustomize bool, images *controller.ImageMap) {
+	for _, cluster := range clusters.Cluster {
+		ctx, cancel := clusterContext(cmd, &cluster)
+		yamlCon, err := controller.NewYaml(&cluster)
+		if err != nil {
+			cancel()
+			fmt.Printf("# Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+			log.Printf("Failed to connect: %v\n", err)
+			continue
+		}
+		manifest, source, err := yamlCon.RenderManifest(ctx, &path, kustomize, templated, images, &cluster)
+		cancel()
+		if err != nil {
+			fmt.Printf("# Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+			log.Printf("Failed to render yaml: %v\n", err)
+			continue
+		}
+
+		fmt.Printf("# Cluster: %s (%s) %s\n", cluster.Name, cluster.Host, source)
+		fmt.Println("---")
+		fmt.Print(strings.TrimPrefix(manifest, "---\n"))
+		if !strings.HasSuffix(manifest, "\n") {
+			fmt.Println()
+		}
+	}
+}
+
 func init() {
 	applyCmd.Flags().StringVarP(&yamlPath, "file", "f", "", "The yaml file path")
-	applyCmd.MarkFlagRequired("file")
+	applyCmd.Flags().StringVarP(&kustomizeDir, "kustomize", "k", "", "The kustomization directory")
+	applyCmd.Flags().BoolVar(&templated, "template", false, "Render the manifest as a Go template with the vars of each cluster")
+	applyCmd.Flags().BoolVar(&renderOnly, "render-only", false, "Print the manifest rendered for each cluster without applying it")
+	applyCmd.Flags().BoolVar(&resolveArch, "resolve-arch", false, "Use the image built for the architecture of each cluster's nodes")
+	applyCmd.Flags().StringVar(&imageMapPath, "image-map", "", "The file mapping images to their image per architecture")
+	applyCmd.Flags().BoolVar(&prune, "prune", false, "Delete the objects of the selector's apply set that are not in the manifest")
+	applyCmd.Flags().StringVarP(&selector, "selector", "l", "", "The label selector of the apply set to prune")
+	applyCmd.Flags().StringVar(&applySetName, "apply-set", "", "The name of the apply set to prune, by default the yaml file or overlay")
+	applyCmd.Flags().StringSliceVar(&pruneKinds, "prune-allowlist", nil, "The kinds to prune (default Deployment,Service)")
+	applyCmd.Flags().BoolVar(&dryRun, "dry-run", false, "With --prune, print the objects that would be pruned without applying")
+	applyCmd.MarkFlagsOneRequired("file", "kustomize")
+	applyCmd.MarkFlagsMutuallyExclusive("file", "kustomize")
+	applyCmd.MarkFlagsRequiredTogether("prune", "selector")
 }
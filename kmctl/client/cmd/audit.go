@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+var (
+	auditCaller string
+	auditMethod string
+	auditSince  time.Duration
+	auditLimit  int
+)
+
+type clusterAuditEntry struct {
+	cluster string
+	entry   *pb.AuditEntry
+}
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit log of mutating operations from all clusters",
+	Long: `Show the audit log of mutating operations from all clusters, merged into one timeline.
+
+	For example:
+	audit
+	audit --since 24h --method DeleteYaml
+	audit --caller alice --limit 20`,
+	Run: func(cmd *cobra.Command, args []string) {
+		request := &pb.GetAuditLogRequest{
+			Caller: auditCaller,
+			Method: auditMethod,
+			Limit:  int32(auditLimit),
+		}
+		if auditSince > 0 {
+			request.Since = timestamppb.New(time.Now().Add(-auditSince))
+		}
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			entries []clusterAuditEntry
+		)
+		for _, cluster := range clusters.Cluster {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				auditCon, err := controller.NewAudit(&cluster)
+				if err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					printConnectError(&cluster, err)
+					return
+				}
+				clusterEntries, err := auditCon.GetAuditLog(ctx, request, &cluster)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Printf("  Failed to get audit log: %v\n\n", err)
+					return
+				}
+				for _, entry := range clusterEntries {
+					entries = append(entries, clusterAuditEntry{cluster: cluster.Name, entry: entry})
+				}
+			}(cluster)
+		}
+		wg.Wait()
+
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].entry.Time.AsTime().Before(entries[j].entry.Time.AsTime())
+		})
+
+		if auditLimit > 0 && len(entries) > auditLimit {
+			entries = entries[len(entries)-auditLimit:]
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tCLUSTER\tCALLER\tPEER\tMETHOD\tRESULT\tDURATION\tOBJECTS")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%dms\t%s\n",
+				e.entry.Time.AsTime().Local().Format(time.DateTime),
+				e.cluster,
+				e.entry.Caller,
+				e.entry.Peer,
+				e.entry.Method,
+				e.entry.Result,
+				e.entry.DurationMs,
+				strings.Join(e.entry.Objects, ","),
+			)
+		}
+		w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringVarP(&auditCaller, "caller", "c", "", "Only show operations by this caller")
+	auditCmd.Flags().StringVarP(&auditMethod, "method", "m", "", "Only show this RPC, e.g. ApplyYaml")
+	auditCmd.Flags().DurationVar(&auditSince, "since", 0, "Only show operations newer than this, e.g. 24h")
+	auditCmd.Flags().IntVarP(&auditLimit, "limit", "l", 100, "Maximum number of entries, 0 for all")
+}
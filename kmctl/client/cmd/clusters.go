@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+)
+
+// clustersCmd represents the clusters command
+var clustersCmd = &cobra.Command{
+	Use:   "clusters",
+	Short: "Get the kubeconfig contexts served by every server.",
+	Long: `Get the kubeconfig contexts served by every server.
+	The default context of a server is marked with *.
+	
+	For example:
+	get clusters`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Get clusters\n")
+		fmt.Println()
+
+		// entries naming different contexts of one server share it
+		servers := make(map[string]model.Cluster)
+		for _, cluster := range clusters.Cluster {
+			address := cluster.Host + ":" + cluster.Port
+			if _, ok := servers[address]; !ok {
+				servers[address] = cluster
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, cluster := range servers {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				getCon, err := controller.NewGet(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				getCon.GetClusters(ctx, &cluster)
+				fmt.Println()
+			}(cluster)
+		}
+		wg.Wait()
+	},
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+)
+
+// componentsCmd represents the components command
+var componentsCmd = &cobra.Command{
+	Use:   "components",
+	Short: "Get the upgradable components of every server.",
+	Long: `Get the upgradable components of every server: the upgrade type number,
+	the name upgrade -t takes, the description and the Deployments of each.
+	
+	For example:
+	get components`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Printf("Get components\n")
+		fmt.Println()
+
+		// entries naming different contexts of one server share it
+		servers := make(map[string]model.Cluster)
+		for _, cluster := range clusters.Cluster {
+			address := cluster.Host + ":" + cluster.Port
+			if _, ok := servers[address]; !ok {
+				servers[address] = cluster
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, cluster := range servers {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				getCon, err := controller.NewGet(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				getCon.GetComponents(ctx, &cluster)
+				fmt.Println()
+			}(cluster)
+		}
+		wg.Wait()
+	},
+}
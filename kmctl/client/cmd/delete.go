@@ -15,11 +15,20 @@ var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "Delete kubernetes yaml file from the all clusters",
 	Long: `Delete kubernetes yaml file from the all clusters.
+
+	-k renders a kustomization directory for each cluster like apply -k and
+	deletes every object in it. --template renders the manifest with the vars
+	of each cluster like apply.
 	
 	For example:
-	delete -f <yaml-file-path>`,
+	delete -f <yaml-file-path>
+	delete -k <kustomization-dir>`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("Delete: %s\n", yamlPath)
+		source := yamlPath
+		if kustomizeDir != "" {
+			source = kustomizeDir
+		}
+		fmt.Printf("Delete: %s\n", source)
 		fmt.Println()
 
 		var wg sync.WaitGroup
@@ -27,8 +36,18 @@ var deleteCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				yamlCon := controller.NewYaml(&cluster.Host, &cluster.Port)
-				yamlCon.DeleteYaml(&yamlPath, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				yamlCon, err := controller.NewYaml(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				if kustomizeDir != "" {
+					yamlCon.DeleteKustomize(ctx, &kustomizeDir, templated, &cluster)
+				} else {
+					yamlCon.DeleteYaml(ctx, &yamlPath, templated, &cluster)
+				}
 				fmt.Println()
 			}(cluster)
 		}
@@ -38,5 +57,8 @@ var deleteCmd = &cobra.Command{
 
 func init() {
 	deleteCmd.Flags().StringVarP(&yamlPath, "file", "f", "", "The yaml file path")
-	deleteCmd.MarkFlagRequired("file")
+	deleteCmd.Flags().StringVarP(&kustomizeDir, "kustomize", "k", "", "The kustomization directory")
+	deleteCmd.Flags().BoolVar(&templated, "template", false, "Render the manifest as a Go template with the vars of each cluster")
+	deleteCmd.MarkFlagsOneRequired("file", "kustomize")
+	deleteCmd.MarkFlagsMutuallyExclusive("file", "kustomize")
 }
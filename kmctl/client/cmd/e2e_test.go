@@ -0,0 +1,900 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+	servercontroller "com.kubebackend/m/server/controller"
+	servermodel "com.kubebackend/m/server/model"
+)
+
+// The suite runs two servers over bufconn: "lab" fronts the simulators
+// sim-01 and sim-02 as kubeconfig contexts, "robot" fronts robot-01.
+var (
+	testDir      string
+	testConfig   string
+	testBackends = map[string]*servercontroller.KubeController{}
+	// kmctl commands share package state, so they run one at a time
+	kmctlMu sync.Mutex
+)
+
+const testClientConfig = `server:
+  - name: sim-01
+    host: passthrough:///lab
+    port: "50051"
+    context: sim-01
+    group: sim
+    vars:
+      robot_id: "101"
+  - name: sim-02
+    host: passthrough:///lab
+    port: "50051"
+    context: sim-02
+    group: sim
+    vars:
+      robot_id: "102"
+      site: lab-2
+  - name: robot-01
+    host: passthrough:///robot
+    port: "50051"
+    vars:
+      robot_id: "1"
+      site: factory
+      registry: registry.factory
+groups:
+  - name: sim
+    vars:
+      site: lab
+      registry: registry.lab
+`
+
+func TestMain(m *testing.M) {
+	var err error
+	testDir, err = os.MkdirTemp("", "kmctl-e2e")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listeners := map[string]*bufconn.Listener{
+		"lab:50051":   startTestServer("lab", "sim-01", "sim-02"),
+		"robot:50051": startTestServer("robot", "robot-01"),
+	}
+	controller.DialOptions = []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			lis, ok := listeners[addr]
+			if !ok {
+				return nil, fmt.Errorf("no test server at %s", addr)
+			}
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}
+
+	testConfig = filepath.Join(testDir, "config.yaml")
+	if err := os.WriteFile(testConfig, []byte(testClientConfig), 0600); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(testDir)
+	os.Exit(code)
+}
+
+func startTestServer(name string, clusterNames ...string) *bufconn.Listener {
+	config := servermodel.Config{
+		Database: filepath.Join(testDir, name+".db"),
+		Components: []servermodel.Component{
+			{Type: 0, Name: "MICOM_MANAGER", Table: "micom_managers"},
+			{Type: 1, Name: "DEVICE_BRINGUP", Table: "device_bringups"},
+			{Type: 2, Name: "NAVIGATION", Table: "navigations", Description: "Navigation", Deployments: []string{"default/e2e-navigation"}},
+			{Type: 3, Name: "MIDDLEWARE", Table: "middlewares"},
+		},
+	}
+
+	var backends []servercontroller.Backend
+	for _, clusterName := range clusterNames {
+		backend := servercontroller.NewFakeKubeController(clusterName, testObjects(clusterName)...)
+		testBackends[clusterName] = backend
+		backends = append(backends, backend)
+	}
+
+	s, err := servercontroller.NewServerWithBackends(&config, backends)
+	if err != nil {
+		log.Fatalf("Failed to create %s server: %v", name, err)
+	}
+
+	auditor := servercontroller.NewAuditor(s.DB(), s.DefaultCluster())
+	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(auditor.UnaryInterceptor()))
+	pb.RegisterKubeBackendServer(grpcServer, s)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go grpcServer.Serve(lis)
+
+	return lis
+}
+
+func testObjects(clusterName string) []runtime.Object {
+	arch := "arm64"
+	if clusterName == "robot-01" {
+		arch = "amd64"
+	}
+
+	return []runtime.Object{
+		&corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        clusterName + "-node",
+				Labels:      map[string]string{"kubernetes.io/arch": arch},
+				Annotations: map[string]string{"k3s.io/internal-ip": "10.0.0.1"},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "navigation-" + clusterName,
+				Namespace: "default",
+				Labels:    map[string]string{"app": "navigation"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "navigation", Image: "registry.local/navigation:24.12.1"}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		},
+	}
+}
+
+// runKmctl runs kmctl with args against the test servers and returns what
+// it printed.
+func runKmctl(t *testing.T, args ...string) string {
+	t.Helper()
+
+	out, err := runKmctlErr(t, args...)
+	if err != nil {
+		t.Fatalf("kmctl %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+
+	return out
+}
+
+// runKmctlErr is runKmctl for commands expected to fail.
+func runKmctlErr(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	kmctlMu.Lock()
+	defer kmctlMu.Unlock()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	log.SetOutput(w)
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+	}()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+
+	clusters = model.Clusters{}
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(append([]string{"--config", testConfig}, args...))
+	err = rootCmd.ExecuteContext(context.Background())
+	w.Close()
+
+	return <-output, err
+}
+
+// resetFlags restores every flag to its default, since cobra keeps the values
+// of the previous run.
+func resetFlags(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	})
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
+
+func writeManifest(t *testing.T, manifest string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// withoutLogs drops the log lines the in-process servers write to the
+// captured output.
+func withoutLogs(out string) string {
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) >= 19 {
+			if _, err := time.Parse("2006/01/02 15:04:05", line[:19]); err == nil {
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func assertContains(t *testing.T, out string, wants ...string) {
+	t.Helper()
+
+	for _, want := range wants {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestGetNodes(t *testing.T) {
+	out := runKmctl(t, "get", "nodes")
+
+	assertContains(t, out,
+		"Cluster: sim-01", "sim-01-node: 10.0.0.1",
+		"Cluster: sim-02", "sim-02-node: 10.0.0.1",
+		"Cluster: robot-01", "robot-01-node: 10.0.0.1",
+	)
+}
+
+func TestGetNode(t *testing.T) {
+	out := runKmctl(t, "get", "node", "-n", "sim-02-node")
+
+	assertContains(t, out, "Name: sim-02-node", "Architecture: arm64", "There is no node with that name")
+}
+
+func TestGetPods(t *testing.T) {
+	out := runKmctl(t, "get", "pods", "-s", "default")
+
+	assertContains(t, out, "navigation-sim-01", "navigation-sim-02", "navigation-robot-01", "Running")
+}
+
+func TestGetClusters(t *testing.T) {
+	out := runKmctl(t, "get", "clusters")
+
+	assertContains(t, out, "sim-01*", "sim-02", "robot-01*", "Ready", "fake://sim-02")
+}
+
+func TestLogs(t *testing.T) {
+	out := runKmctl(t, "logs", "-n", "navigation-sim-01", "-s", "default")
+
+	assertContains(t, out, "fake logs")
+}
+
+func TestApplyAndDelete(t *testing.T) {
+	path := writeManifest(t, `apiVersion: v1
+kind: Service
+metadata:
+  name: e2e-apply
+  namespace: default
+spec:
+  ports:
+    - port: 80
+`)
+
+	out := runKmctl(t, "apply", "-f", path)
+	assertContains(t, out, "Apply Yaml Response")
+
+	for name, backend := range testBackends {
+		if _, err := backend.Clientset.CoreV1().Services("default").Get(context.Background(), "e2e-apply", metav1.GetOptions{}); err != nil {
+			t.Errorf("%s: service not applied: %v", name, err)
+		}
+	}
+
+	out = runKmctl(t, "delete", "-f", path)
+	assertContains(t, out, "Delete Yaml Response")
+
+	for name, backend := range testBackends {
+		_, err := backend.Clientset.CoreV1().Services("default").Get(context.Background(), "e2e-apply", metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			t.Errorf("%s: service not deleted: %v", name, err)
+		}
+	}
+}
+
+func TestApplyAndDeleteKustomize(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base/kustomization.yaml": "resources:\n  - service.yaml\n  - deployment.yaml\n",
+		"base/service.yaml":       "apiVersion: v1\nkind: Service\nmetadata:\n  name: e2e-kustomize\n  namespace: default\nspec:\n  ports:\n    - port: 80\n",
+		"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: e2e-kustomize
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: e2e-kustomize
+  template:
+    metadata:
+      labels:
+        app: e2e-kustomize
+    spec:
+      containers:
+        - name: navigation
+          image: registry.local/navigation:24.12.1
+`,
+		"overlays/sim/kustomization.yaml":      "resources:\n  - ../../base\nimages:\n  - name: registry.local/navigation\n    newTag: 24.12.1-sim\n",
+		"overlays/robot-01/kustomization.yaml": "resources:\n  - ../../base\nimages:\n  - name: registry.local/navigation\n    newTag: 24.12.1-arm64\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := runKmctl(t, "apply", "-k", dir)
+	assertContains(t, out, filepath.Join(dir, "overlays", "sim"), filepath.Join(dir, "overlays", "robot-01"))
+
+	wantTags := map[string]string{"sim-01": "24.12.1-sim", "sim-02": "24.12.1-sim", "robot-01": "24.12.1-arm64"}
+	for name, backend := range testBackends {
+		deployment, err := backend.Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-kustomize", metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("%s: deployment not applied: %v", name, err)
+			continue
+		}
+		if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "registry.local/navigation:"+wantTags[name] {
+			t.Errorf("%s: image = %s, want the %s overlay", name, image, wantTags[name])
+		}
+		if _, err := backend.Clientset.CoreV1().Services("default").Get(context.Background(), "e2e-kustomize", metav1.GetOptions{}); err != nil {
+			t.Errorf("%s: service not applied: %v", name, err)
+		}
+	}
+
+	out = runKmctl(t, "delete", "-k", dir)
+	assertContains(t, out, "Delete Yaml Response")
+
+	for name, backend := range testBackends {
+		_, err := backend.Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-kustomize", metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			t.Errorf("%s: deployment not deleted: %v", name, err)
+		}
+	}
+}
+
+const testTemplate = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: e2e-template
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: e2e-template
+  template:
+    metadata:
+      labels:
+        app: e2e-template
+    spec:
+      containers:
+        - name: navigation
+          image: {{ .Vars.registry }}/navigation:24.12.3
+          env:
+            - name: ROBOT_ID
+              value: "{{ .Vars.robot_id }}"
+            - name: SITE
+              value: {{ .Vars.site }}
+`
+
+func TestApplyTemplate(t *testing.T) {
+	path := writeManifest(t, testTemplate)
+
+	out := runKmctl(t, "apply", "-f", path, "--template", "--render-only")
+	assertContains(t, out,
+		"# Cluster: sim-02 (passthrough:///lab)",
+		"image: registry.lab/navigation:24.12.3", `value: "102"`, "value: lab-2",
+		"image: registry.factory/navigation:24.12.3", "value: factory",
+	)
+	if _, err := testBackends["sim-01"].Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-template", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("render-only applied the manifest: %v", err)
+	}
+
+	runKmctl(t, "apply", "-f", path, "--template")
+
+	want := map[string][]string{
+		"sim-01":   {"registry.lab", "101", "lab"},
+		"sim-02":   {"registry.lab", "102", "lab-2"},
+		"robot-01": {"registry.factory", "1", "factory"},
+	}
+	for name, backend := range testBackends {
+		deployment, err := backend.Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-template", metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("%s: deployment not applied: %v", name, err)
+			continue
+		}
+		container := deployment.Spec.Template.Spec.Containers[0]
+		got := []string{strings.TrimSuffix(container.Image, "/navigation:24.12.3"), container.Env[0].Value, container.Env[1].Value}
+		if strings.Join(got, " ") != strings.Join(want[name], " ") {
+			t.Errorf("%s: rendered %v, want %v", name, got, want[name])
+		}
+	}
+
+	runKmctl(t, "delete", "-f", path, "--template")
+}
+
+func TestApplyTemplateMissingVar(t *testing.T) {
+	path := writeManifest(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: e2e-{{ .Vars.map_name }}\n")
+
+	out := runKmctl(t, "apply", "-f", path, "--template")
+	assertContains(t, out, `map has no entry for key "map_name"`)
+	if strings.Contains(out, "Apply Yaml Response") {
+		t.Errorf("applied a manifest with a missing variable:\n%s", out)
+	}
+}
+
+func TestApplyLiteralBraces(t *testing.T) {
+	// e.g. a Helm or Prometheus template stored in a ConfigMap
+	path := writeManifest(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: e2e-braces\n  annotations:\n    summary: \"{{ $labels.instance }} is down\"\n")
+
+	out := runKmctl(t, "apply", "-f", path, "--render-only")
+	assertContains(t, out, `summary: "{{ $labels.instance }} is down"`)
+
+	out = runKmctl(t, "apply", "-f", path)
+	assertContains(t, out, "Apply Yaml Response")
+	service, err := testBackends["sim-01"].Clientset.CoreV1().Services("default").Get(context.Background(), "e2e-braces", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("service not applied: %v", err)
+	}
+	if summary := service.Annotations["summary"]; summary != "{{ $labels.instance }} is down" {
+		t.Errorf("summary = %q, want the braces as written", summary)
+	}
+
+	runKmctl(t, "delete", "-f", path)
+}
+
+const testArchDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: e2e-arch
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: e2e-arch
+  template:
+    metadata:
+      labels:
+        app: e2e-arch
+      annotations:
+        images.kube-backend/navigation: arm64=registry.local/navigation:24.12.3-arm64,amd64=registry.local/navigation:24.12.3-amd64
+    spec:
+      containers:
+        - name: navigation
+          image: registry.local/navigation:24.12.3
+        - name: middleware
+          image: registry.local/middleware:1.0.0
+`
+
+func deploymentImages(t *testing.T, clusterName, name string) []string {
+	t.Helper()
+
+	deployment, err := testBackends[clusterName].Clientset.AppsV1().Deployments("default").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("%s: deployment not applied: %v", clusterName, err)
+		return nil
+	}
+
+	var images []string
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+func TestApplyResolveArch(t *testing.T) {
+	path := writeManifest(t, testArchDeployment)
+
+	runKmctl(t, "apply", "-f", path, "--resolve-arch")
+	defer runKmctl(t, "delete", "-f", path)
+
+	want := map[string]string{"sim-01": "arm64", "sim-02": "arm64", "robot-01": "amd64"}
+	for name, arch := range want {
+		images := deploymentImages(t, name, "e2e-arch")
+		if strings.Join(images, " ") != "registry.local/navigation:24.12.3-"+arch+" registry.local/middleware:1.0.0" {
+			t.Errorf("%s: images = %v, want the %s navigation image", name, images, arch)
+		}
+	}
+}
+
+func TestApplyImageMap(t *testing.T) {
+	path := writeManifest(t, strings.ReplaceAll(testArchDeployment, "e2e-arch", "e2e-image-map"))
+	imageMap := filepath.Join(t.TempDir(), "images.yaml")
+	mapping := "images:\n  registry.local/middleware:1.0.0:\n    arm64: registry.local/middleware:1.0.0-arm64\n"
+	if err := os.WriteFile(imageMap, []byte(mapping), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runKmctl(t, "apply", "-f", path, "--image-map", imageMap, "--render-only")
+	assertContains(t, out, "image: registry.local/middleware:1.0.0-arm64", "no image for amd64 nodes (registry.local/middleware:1.0.0)")
+
+	out = runKmctl(t, "apply", "-f", path, "--image-map", imageMap)
+	defer runKmctl(t, "delete", "-f", path)
+	assertContains(t, out, "Deployment/e2e-image-map container middleware: no image for amd64 nodes")
+
+	for _, name := range []string{"sim-01", "sim-02"} {
+		images := deploymentImages(t, name, "e2e-image-map")
+		if strings.Join(images, " ") != "registry.local/navigation:24.12.3-arm64 registry.local/middleware:1.0.0-arm64" {
+			t.Errorf("%s: images = %v, want the arm64 images", name, images)
+		}
+	}
+	_, err := testBackends["robot-01"].Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-image-map", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("robot-01: applied an image without an amd64 build: %v", err)
+	}
+}
+
+func TestApplyPrune(t *testing.T) {
+	service := "apiVersion: v1\nkind: Service\nmetadata:\n  name: %s\n  namespace: default\n  labels:\n    app.kubernetes.io/part-of: e2e-stack\nspec:\n  ports:\n    - port: 80\n"
+	full := writeManifest(t, fmt.Sprintf(service, "e2e-prune-kept")+"---\n"+fmt.Sprintf(service, "e2e-prune-removed"))
+	reduced := writeManifest(t, fmt.Sprintf(service, "e2e-prune-kept"))
+	selector := "app.kubernetes.io/part-of=e2e-stack"
+
+	out := runKmctl(t, "apply", "-f", full, "--prune", "-l", selector, "--apply-set", "e2e-stack")
+	assertContains(t, out, "Apply Yaml Response", "Nothing to prune")
+
+	out = runKmctl(t, "apply", "-f", reduced, "--prune", "-l", selector, "--apply-set", "e2e-stack", "--dry-run")
+	assertContains(t, out, "Prune Preview", "Would prune: Service/default/e2e-prune-removed")
+
+	out = runKmctl(t, "apply", "-f", reduced, "--prune", "-l", selector, "--apply-set", "e2e-stack", "--prune-allowlist", "Deployment")
+	assertContains(t, out, "Nothing to prune")
+
+	out = runKmctl(t, "apply", "-f", reduced, "--prune", "-l", selector, "--apply-set", "e2e-stack")
+	assertContains(t, out, "Pruned: Service/default/e2e-prune-removed")
+
+	for name, backend := range testBackends {
+		_, err := backend.Clientset.CoreV1().Services("default").Get(context.Background(), "e2e-prune-removed", metav1.GetOptions{})
+		if !errors.IsNotFound(err) {
+			t.Errorf("%s: service not pruned: %v", name, err)
+		}
+		if _, err := backend.Clientset.CoreV1().Services("default").Get(context.Background(), "e2e-prune-kept", metav1.GetOptions{}); err != nil {
+			t.Errorf("%s: kept service is gone: %v", name, err)
+		}
+	}
+
+	runKmctl(t, "delete", "-f", reduced)
+}
+
+func TestInventory(t *testing.T) {
+	shared := writeManifest(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: shared\n  namespace: e2e-inventory\n")
+	perRobot := writeManifest(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: per-robot\n  namespace: e2e-inventory\n  annotations:\n    robot: \"{{ .Vars.robot_id }}\"\n")
+	runKmctl(t, "apply", "-f", shared)
+	runKmctl(t, "apply", "-f", perRobot, "--template")
+
+	out := runKmctl(t, "inventory", "-s", "e2e-inventory")
+	assertContains(t, out, "OBJECT", "Service/e2e-inventory/shared", shared, "same", "3/3", "Service/e2e-inventory/per-robot", "differs")
+
+	out = runKmctl(t, "inventory", "-s", "e2e-inventory", "--diff")
+	assertContains(t, out, "Service/e2e-inventory/per-robot", ": robot-01; ")
+	if strings.Contains(out, "Service/e2e-inventory/shared") {
+		t.Errorf("--diff shows an object that is the same everywhere:\n%s", out)
+	}
+
+	runKmctl(t, "delete", "-f", perRobot, "--template")
+	out = runKmctl(t, "inventory", "-s", "e2e-inventory")
+	if strings.Contains(out, "per-robot") {
+		t.Errorf("deleted object is still in the inventory:\n%s", out)
+	}
+	runKmctl(t, "delete", "-f", shared)
+}
+
+func TestWait(t *testing.T) {
+	interval := servercontroller.WaitPollInterval
+	servercontroller.WaitPollInterval = 20 * time.Millisecond
+	defer func() { servercontroller.WaitPollInterval = interval }()
+
+	out := runKmctl(t, "wait", "pod", "-l", "app=navigation", "--for", "jsonpath={.status.phase}=Running")
+	assertContains(t, out, "[sim-01] navigation-sim-01: Running", "Condition met: robot-01, sim-01, sim-02")
+
+	out, err := runKmctlErr(t, "wait", "pod", "-l", "app=navigation", "--for", "condition=Ready", "--timeout", "200ms")
+	if err == nil {
+		t.Errorf("wait succeeded without ready pods:\n%s", out)
+	}
+	assertContains(t, out, "Condition met: \n", "Timed out: robot-01 (navigation-robot-01: no Ready condition)")
+
+	// sim-01 becomes ready while kmctl waits
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		pod, err := testBackends["sim-01"].Clientset.CoreV1().Pods("default").Get(context.Background(), "navigation-sim-01", metav1.GetOptions{})
+		if err != nil {
+			return
+		}
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		testBackends["sim-01"].Clientset.CoreV1().Pods("default").UpdateStatus(context.Background(), pod, metav1.UpdateOptions{})
+	}()
+	out, err = runKmctlErr(t, "wait", "pod", "-l", "app=navigation", "--for", "condition=Ready", "--timeout", "1s")
+	if err == nil || !strings.Contains(err.Error(), "not met on 2 of 3 clusters") {
+		t.Errorf("wait error = %v, want 2 of 3 clusters", err)
+	}
+	assertContains(t, out, "[sim-01] navigation-sim-01: Ready=True", "Condition met: sim-01\n", "Timed out: robot-01", "sim-02 (navigation-sim-02: no Ready condition)")
+
+	// without --timeout a cluster waits for its own timeout
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	robot := "server:\n  - name: robot-01\n    host: passthrough:///robot\n    port: \"50051\"\n    timeout: 200ms\n"
+	if err := os.WriteFile(config, []byte(robot), 0600); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	out, err = runKmctlErr(t, "--config", config, "wait", "pod", "-l", "app=navigation", "--for", "condition=Ready")
+	if err == nil || time.Since(start) > 5*time.Second {
+		t.Errorf("wait = %v after %s, want a timeout after the cluster timeout", err, time.Since(start))
+	}
+	assertContains(t, out, "Timed out: robot-01 (navigation-robot-01: no Ready condition)")
+
+	out = runKmctl(t, "wait", "service/e2e-wait-missing", "--for", "delete")
+	assertContains(t, out, "[robot-01] deleted", "Condition met: robot-01, sim-01, sim-02")
+
+	out, err = runKmctlErr(t, "wait", "secret/token", "--for", "delete")
+	if err == nil {
+		t.Errorf("wait for an unsupported kind succeeded")
+	}
+	assertContains(t, out, "Failed: robot-01 (unsupported kind \"secret\"")
+}
+
+func TestUpgrade(t *testing.T) {
+	path := writeManifest(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: e2e-navigation
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: e2e-navigation
+  template:
+    metadata:
+      labels:
+        app: e2e-navigation
+    spec:
+      containers:
+        - name: navigation
+          image: registry.local/navigation:24.12.3
+`)
+
+	out := runKmctl(t, "upgrade", "-t", "2", "-v", "24.12", "-f", path)
+	assertContains(t, out, "Upgrade failed: INVALID_VERSION (NAVIGATION 24.12)", "Cluster not changed")
+	for name, backend := range testBackends {
+		if _, err := backend.Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-navigation", metav1.GetOptions{}); !errors.IsNotFound(err) {
+			t.Errorf("%s: deployment applied with an invalid version: %v", name, err)
+		}
+	}
+
+	out = runKmctl(t, "upgrade", "-t", "navigation", "-v", "24.12.3", "-f", path)
+	assertContains(t, out, "Upgrade Yaml Response")
+	if strings.Contains(out, "Failed") {
+		t.Errorf("upgrade failed:\n%s", out)
+	}
+
+	for name, backend := range testBackends {
+		if _, err := backend.Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-navigation", metav1.GetOptions{}); err != nil {
+			t.Errorf("%s: deployment not applied: %v", name, err)
+		}
+	}
+}
+
+func TestUpgradeHistory(t *testing.T) {
+	path := writeManifest(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: e2e-middleware\n  namespace: default\n")
+	runKmctl(t, "upgrade", "-t", "3", "-v", "24.10.1", "-f", path)
+	runKmctl(t, "upgrade", "-t", "3", "-v", "24.12.5", "-f", path)
+
+	out := runKmctl(t, "upgrade", "history", "-t", "middleware")
+	assertContains(t, out, "TIME", "COMPONENT")
+	for _, cluster := range []string{"robot-01", "sim-01", "sim-02"} {
+		if strings.Count(out, cluster) != 2 {
+			t.Errorf("%s does not have its 2 upgrades:\n%s", cluster, out)
+		}
+	}
+	if strings.Index(out, "24.10.1") > strings.Index(out, "24.12.5") {
+		t.Errorf("history is not oldest first:\n%s", out)
+	}
+
+	out = withoutLogs(runKmctl(t, "upgrade", "history", "-t", "MIDDLEWARE", "-o", "csv", "--limit", "3"))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 || lines[0] != "time,cluster,component,version,action" || !strings.HasSuffix(lines[3], ",MIDDLEWARE,24.12.5,upgrade") {
+		t.Errorf("csv export:\n%s", out)
+	}
+
+	out = withoutLogs(runKmctl(t, "upgrade", "history", "-t", "3", "-o", "json", "--until", "1h"))
+	if strings.TrimSpace(out) != "[]" {
+		t.Errorf("json export of old upgrades = %s, want []", out)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	path := writeManifest(t, "apiVersion: v1\nkind: Service\nmetadata:\n  name: e2e-audit\nspec:\n  ports:\n    - port: 80\n")
+	runKmctl(t, "apply", "-f", path)
+
+	out := runKmctl(t, "audit", "--method", "ApplyYaml")
+	assertContains(t, out, "sim-01", "sim-02", "robot-01", "Service/default/e2e-audit", "OK")
+
+	// the controller returns only the entries of the cluster's context
+	cluster := model.Cluster{Name: "sim-02", Host: "passthrough:///lab", Port: "50051", Context: "sim-02"}
+	auditCon, err := controller.NewAudit(&cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := auditCon.GetAuditLog(context.Background(), &pb.GetAuditLogRequest{}, &cluster)
+	if err != nil {
+		t.Fatalf("GetAuditLog: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("no audit entries for sim-02")
+	}
+	for _, entry := range entries {
+		if entry.Cluster != "sim-02" {
+			t.Errorf("entry of cluster %s returned for sim-02", entry.Cluster)
+		}
+	}
+}
+
+func TestUnknownContext(t *testing.T) {
+	cluster := model.Cluster{Name: "sim-99", Host: "passthrough:///lab", Port: "50051", Context: "sim-99"}
+	client, err := controller.GetClient(&cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (*client).GetNodes(context.Background(), &pb.GetNodesRequest{Cluster: cluster.Context})
+	if err == nil || !strings.Contains(err.Error(), `unknown cluster "sim-99"`) {
+		t.Errorf("GetNodes on an unknown context = %v, want unknown cluster", err)
+	}
+}
+
+func TestInvalidClusterTLS(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	broken := `  - name: broken
+    host: passthrough:///robot
+    port: "50051"
+    tls:
+      ca: /nonexistent/ca.crt
+`
+	content := strings.Replace(testClientConfig, "groups:\n", broken+"groups:\n", 1)
+	if err := os.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runKmctl(t, "--config", config, "get", "nodes")
+	assertContains(t, out, "Cluster: broken (passthrough:///robot)", "Failed to connect: failed to load TLS config", "Cluster: robot-01")
+}
+
+func TestVersions(t *testing.T) {
+	manifest := "apiVersion: v1\nkind: Service\nmetadata:\n  name: e2e-bringup\n  namespace: default\n"
+	runKmctl(t, "upgrade", "-t", "1", "-v", "24.11.0", "-f", writeManifest(t, manifest))
+
+	// only robot-01 gets the newer version
+	cluster := model.Cluster{Name: "robot-01", Host: "passthrough:///robot", Port: "50051"}
+	client, err := controller.GetClient(&cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (*client).UpgradeYaml(context.Background(), &pb.UpgradeYamlRequest{Type: 1, Yaml: manifest, Version: "24.11.2"}); err != nil {
+		t.Fatalf("UpgradeYaml: %v", err)
+	}
+
+	out := withoutLogs(runKmctl(t, "versions"))
+	assertContains(t, out, "CLUSTER", "DEVICE_BRINGUP", "FLEET MAX", "clusters behind the fleet max")
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "robot-01"):
+			if !strings.Contains(line, "24.11.2") || strings.Contains(line, "24.11.2 *") {
+				t.Errorf("robot-01 row = %q, want 24.11.2 not behind", line)
+			}
+		case strings.HasPrefix(line, "sim-01"), strings.HasPrefix(line, "sim-02"):
+			if !strings.Contains(line, "24.11.0 *") {
+				t.Errorf("sim row = %q, want 24.11.0 behind", line)
+			}
+		}
+	}
+
+	target := filepath.Join(t.TempDir(), "target.yaml")
+	if err := os.WriteFile(target, []byte("device_bringup: 24.12.0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out = withoutLogs(runKmctl(t, "versions", "--target", target))
+	assertContains(t, out, "TARGET", "24.11.2 *", "clusters behind the target")
+
+	if err := os.WriteFile(target, []byte("device_bringup: 24.12\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runKmctlErr(t, "versions", "--target", target); err == nil || !strings.Contains(err.Error(), "invalid target version of device_bringup") {
+		t.Errorf("versions with an invalid target = %v", err)
+	}
+}
+
+func TestUpgradeRollback(t *testing.T) {
+	release := func(version string) string {
+		return writeManifest(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: e2e-micom
+  namespace: default
+spec:
+  selector:
+    matchLabels:
+      app: e2e-micom
+  template:
+    metadata:
+      labels:
+        app: e2e-micom
+    spec:
+      containers:
+        - name: micom
+          image: registry.local/micom:`+version+"\n")
+	}
+	runKmctl(t, "upgrade", "-t", "0", "-v", "24.10.0", "-f", release("24.10.0"))
+	runKmctl(t, "upgrade", "-t", "0", "-v", "24.12.0", "-f", release("24.12.0"))
+
+	out := runKmctl(t, "upgrade", "rollback", "-t", "micom_manager")
+	if strings.Count(out, "Rolled back 24.12.0 -> 24.10.0") != 3 {
+		t.Errorf("not rolled back on every cluster:\n%s", out)
+	}
+	for name, backend := range testBackends {
+		deployment, err := backend.Clientset.AppsV1().Deployments("default").Get(context.Background(), "e2e-micom", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "registry.local/micom:24.10.0" {
+			t.Errorf("%s: image = %s, want the stored 24.10.0 manifest", name, image)
+		}
+	}
+
+	out = runKmctl(t, "upgrade", "history", "-t", "micom_manager")
+	if strings.Count(out, "rollback") != 3 {
+		t.Errorf("rollbacks not recorded in the history:\n%s", out)
+	}
+
+	out = runKmctl(t, "upgrade", "rollback", "-t", "0", "--to-version", "23.1.0")
+	assertContains(t, out, "Rollback failed: NO_ROLLBACK_TARGET (MICOM_MANAGER 23.1.0)", "Cluster not changed")
+}
+
+func TestGetComponents(t *testing.T) {
+	out := runKmctl(t, "get", "components")
+	assertContains(t, out, "Server: passthrough:///lab:50051", "Server: passthrough:///robot:50051", "2\tNAVIGATION    \tNavigation\tdefault/e2e-navigation")
+
+	out = runKmctl(t, "upgrade", "-t", "navigaton", "-v", "24.12.3", "-f", writeManifest(t, "kind: Service\nmetadata:\n  name: e2e-typo\n"))
+	if strings.Count(out, `unknown component "navigaton", want one of micom_manager, device_bringup, navigation, middleware`) != 3 {
+		t.Errorf("unknown component not reported for every cluster:\n%s", out)
+	}
+}
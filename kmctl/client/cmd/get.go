@@ -13,7 +13,9 @@ var getCmd = &cobra.Command{
 	Node: Get a node what is same name from all Kubernetes clusters.
 	Nodes: Get all nodes from all kubernetes clusters.
 	Pod: Get a pod what is same name and namespace from all Kubernetes clusters.
-	Pods: Get all pods in namespace from all kubernetes clusters.`,
+	Pods: Get all pods in namespace from all kubernetes clusters.
+	Clusters: Get the kubeconfig contexts served by every server.
+	Components: Get the upgradable components of every server.`,
 }
 
 func init() {
@@ -21,4 +23,6 @@ func init() {
 	getCmd.AddCommand(nodesCmd)
 	getCmd.AddCommand(podCmd)
 	getCmd.AddCommand(podsCmd)
+	getCmd.AddCommand(clustersCmd)
+	getCmd.AddCommand(componentsCmd)
 }
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+var (
+	inventoryKind      string
+	inventoryNamespace string
+	inventoryDiff      bool
+)
+
+// inventoryObject is one object across the clusters that answered.
+type inventoryObject struct {
+	name    string
+	sources []string
+	// hashes maps a short manifest hash to the clusters having it
+	hashes map[string][]string
+}
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Show the objects applied by kmctl on all clusters and where they differ",
+	Long: `Show the objects applied by kmctl on all clusters and where they differ.
+
+	Each server records the objects applied through apply and upgrade, with
+	the hash of their manifest. STATE is "same" when every cluster has the
+	same manifest, "differs" when the manifests differ, and "missing" when
+	some clusters do not have the object.
+
+	For example:
+	inventory
+	inventory --kind Deployment -s robot --diff`,
+	Run: func(cmd *cobra.Command, args []string) {
+		request := &pb.GetInventoryRequest{
+			Kind:      inventoryKind,
+			Namespace: inventoryNamespace,
+		}
+
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			answered []string
+			objects  = map[string]*inventoryObject{}
+		)
+		for _, cluster := range clusters.Cluster {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				inventoryCon, err := controller.NewInventory(&cluster)
+				if err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					printConnectError(&cluster, err)
+					return
+				}
+				entries, err := inventoryCon.GetInventory(ctx, request, &cluster)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Printf("  Failed to get inventory: %v\n\n", err)
+					return
+				}
+				answered = append(answered, cluster.Name)
+				for _, entry := range entries {
+					name := fmt.Sprintf("%s/%s/%s", entry.Kind, entry.Namespace, entry.Name)
+					object, ok := objects[name]
+					if !ok {
+						object = &inventoryObject{name: name, hashes: map[string][]string{}}
+						objects[name] = object
+					}
+					if !slices.Contains(object.sources, entry.Source) {
+						object.sources = append(object.sources, entry.Source)
+					}
+					hash := entry.ManifestHash[:min(8, len(entry.ManifestHash))]
+					object.hashes[hash] = append(object.hashes[hash], cluster.Name)
+				}
+			}(cluster)
+		}
+		wg.Wait()
+
+		names := make([]string, 0, len(objects))
+		for name := range objects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "OBJECT\tSOURCE\tSTATE\tCLUSTERS\tMANIFESTS")
+		for _, name := range names {
+			object := objects[name]
+			state, count, manifests := inventoryState(object, answered)
+			if inventoryDiff && state == "same" {
+				continue
+			}
+			sort.Strings(object.sources)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\n",
+				name,
+				strings.Join(object.sources, ","),
+				state,
+				count,
+				len(answered),
+				manifests,
+			)
+		}
+		w.Flush()
+	},
+}
+
+// inventoryState compares an object across the clusters that answered.
+func inventoryState(object *inventoryObject, answered []string) (string, int, string) {
+	hashes := make([]string, 0, len(object.hashes))
+	count := 0
+	for hash, clusterNames := range object.hashes {
+		hashes = append(hashes, hash)
+		count += len(clusterNames)
+	}
+	sort.Strings(hashes)
+
+	if len(hashes) == 1 && count == len(answered) {
+		return "same", count, hashes[0]
+	}
+
+	var manifests []string
+	for _, hash := range hashes {
+		clusterNames := object.hashes[hash]
+		sort.Strings(clusterNames)
+		manifests = append(manifests, fmt.Sprintf("%s: %s", hash, strings.Join(clusterNames, ",")))
+	}
+
+	state := "differs"
+	if count < len(answered) {
+		var missing []string
+		for _, name := range answered {
+			if !slices.ContainsFunc(hashes, func(hash string) bool { return slices.Contains(object.hashes[hash], name) }) {
+				missing = append(missing, name)
+			}
+		}
+		sort.Strings(missing)
+		manifests = append(manifests, "missing: "+strings.Join(missing, ","))
+		state = "missing"
+	}
+
+	return state, count, strings.Join(manifests, "; ")
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+
+	inventoryCmd.Flags().StringVar(&inventoryKind, "kind", "", "Only show objects of this kind, e.g. Deployment")
+	inventoryCmd.Flags().StringVarP(&inventoryNamespace, "namespace", "s", "", "Only show objects in this namespace")
+	inventoryCmd.Flags().BoolVar(&inventoryDiff, "diff", false, "Only show objects that differ or are missing on some clusters")
+}
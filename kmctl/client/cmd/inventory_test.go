@@ -0,0 +1,28 @@
+package cmd
+
+import "testing"
+
+func TestInventoryState(t *testing.T) {
+	answered := []string{"robot-01", "robot-02", "robot-03"}
+
+	tests := []struct {
+		name      string
+		hashes    map[string][]string
+		state     string
+		count     int
+		manifests string
+	}{
+		{"same", map[string][]string{"aaaa": {"robot-01", "robot-02", "robot-03"}}, "same", 3, "aaaa"},
+		{"differs", map[string][]string{"aaaa": {"robot-03", "robot-01"}, "bbbb": {"robot-02"}}, "differs", 3, "aaaa: robot-01,robot-03; bbbb: robot-02"},
+		{"missing", map[string][]string{"aaaa": {"robot-02"}}, "missing", 1, "aaaa: robot-02; missing: robot-01,robot-03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, count, manifests := inventoryState(&inventoryObject{hashes: tt.hashes}, answered)
+			if state != tt.state || count != tt.count || manifests != tt.manifests {
+				t.Errorf("inventoryState = %s, %d, %q, want %s, %d, %q", state, count, manifests, tt.state, tt.count, tt.manifests)
+			}
+		})
+	}
+}
@@ -33,8 +33,14 @@ var logsCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				logsCon := controller.NewLogs(&cluster.Host, &cluster.Port)
-				logsCon.GetPodLogsStream(&logsPodName, &logsPodNamespace, &logsLines, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				logsCon, err := controller.NewLogs(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				logsCon.GetPodLogsStream(ctx, &logsPodName, &logsPodNamespace, &logsLines, &cluster)
 				fmt.Println()
 			}(cluster)
 		}
@@ -29,8 +29,14 @@ var nodeCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				getCon := controller.NewGet(&cluster.Host, &cluster.Port)
-				getCon.GetNode(&name, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				getCon, err := controller.NewGet(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				getCon.GetNode(ctx, &name, &cluster)
 				fmt.Println()
 			}(cluster)
 		}
@@ -27,8 +27,14 @@ var nodesCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				getCon := controller.NewGet(&cluster.Host, &cluster.Port)
-				getCon.GetNodes(&cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				getCon, err := controller.NewGet(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				getCon.GetNodes(ctx, &cluster)
 				fmt.Println()
 			}(cluster)
 		}
@@ -33,8 +33,14 @@ var podCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				getCon := controller.NewGet(&cluster.Host, &cluster.Port)
-				getCon.GetPod(&podName, &podNamespace, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				getCon, err := controller.NewGet(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				getCon.GetPod(ctx, &podName, &podNamespace, &cluster)
 				fmt.Println()
 			}(cluster)
 		}
@@ -30,8 +30,14 @@ var podsCmd = &cobra.Command{
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				getCon := controller.NewGet(&cluster.Host, &cluster.Port)
-				getCon.GetPods(&namespace, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				getCon, err := controller.NewGet(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				getCon.GetPods(ctx, &namespace, &cluster)
 				fmt.Println()
 			}(cluster)
 		}
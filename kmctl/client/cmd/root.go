@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -12,8 +16,9 @@ import (
 )
 
 var (
-	cfgFile  string
-	clusters model.Clusters
+	cfgFile        string
+	clusters       model.Clusters
+	requestTimeout time.Duration
 
 	rootCmd = &cobra.Command{
 		Use:   "client",
@@ -41,7 +46,53 @@ server:
 - name: cluster2
   port: 50051
   host: 192.168.5.11
+  tls:
+    ca: /home/user/.config/kmctl/certs/ca.crt
+    cert: /home/user/.config/kmctl/certs/kmctl.crt
+    key: /home/user/.config/kmctl/certs/kmctl.key
+    serverName: robot2.local
+  tokenEnv: ROBOT2_TOKEN
+- name: sim-01
+  port: 50051
+  host: 192.168.5.20
+  context: k3d-sim-01
+  group: sim
+- name: sim-02
+  port: 50051
+  host: 192.168.5.20
+  context: k3d-sim-02
+  group: sim
+  vars:
+    robot_id: "02"
  ...
+groups:
+- name: sim
+  vars:
+    registry_mirror: registry.lab.local
+
+context selects one of the kubeconfig contexts served by the server
+(see "get clusters"); the server's default context is used when it is empty.
+
+group names the robot model or fleet of the cluster; apply -k and delete -k
+render <dir>/overlays/<group> for clusters without an overlay of their own.
+
+vars per cluster and per group are the template variables of manifests, e.g.
+{{ .Vars.robot_id }}; a cluster's own vars override those of its group.
+
+TLS settings per cluster (connection is plaintext when none is set):
+  enabled: use TLS with the system CA pool
+  ca: CA certificate that signed the server certificate
+  cert, key: client certificate for mutual TLS
+  serverName: override the server name used for verification
+  insecureSkipVerify: do not verify the server certificate
+
+Bearer token per cluster, when the server requires authentication:
+  token: the token itself
+  tokenEnv: environment variable holding the token (default $KMCTL_TOKEN)
+
+timeout per cluster bounds each call, e.g. 1m for a slow robot. --timeout
+applies to clusters without one, or to every cluster when given explicitly.
+Ctrl-C cancels the calls to every cluster.
 `,
 		Run: func(cmd *cobra.Command, args []string) {
 			version, _ := cmd.Flags().GetBool("version")
@@ -58,16 +109,45 @@ server:
 const VERSION = "0.1.4"
 
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	err := rootCmd.ExecuteContext(ctx)
+	if ctx.Err() != nil {
+		stop()
+		os.Exit(130)
+	}
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// clusterContext bounds the calls to one cluster by its timeout, or by
+// --timeout when the cluster has none or the flag is given explicitly.
+func clusterContext(cmd *cobra.Command, cluster *model.Cluster) (context.Context, context.CancelFunc) {
+	timeout := cluster.RequestTimeout(requestTimeout)
+	if cmd.Flags().Changed("timeout") {
+		timeout = requestTimeout
+	}
+
+	if timeout <= 0 {
+		return context.WithCancel(cmd.Context())
+	}
+	return context.WithTimeout(cmd.Context(), timeout)
+}
+
+// printConnectError reports a cluster whose server cannot be called, e.g.
+// for invalid TLS settings, while the other clusters are still called.
+func printConnectError(cluster *model.Cluster, err error) {
+	fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+	fmt.Printf("  Failed to connect: %v\n\n", err)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/kmctl/config.yaml)")
+	rootCmd.PersistentFlags().DurationVar(&requestTimeout, "timeout", 30*time.Second, "Timeout of the calls to each cluster, 0 for none")
 	rootCmd.Flags().BoolP("version", "v", false, "Print the version of the client")
 
 	rootCmd.AddCommand(getCmd)
@@ -89,6 +169,7 @@ func initConfig() {
 		if err := viper.Unmarshal(&clusters); err != nil {
 			log.Fatalf("Failed to unmarshal config: %v", err)
 		}
+		clusters.MergeGroupVars()
 	} else {
 		log.Fatalf("Failed to read config: %v", err)
 	}
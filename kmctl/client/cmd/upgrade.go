@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -10,7 +11,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var upgradeType int
+var upgradeComponent string
 var upgradeVersion string
 var upgradeYamlPath string
 
@@ -22,9 +23,27 @@ var upgradeCmd = &cobra.Command{
 
 For example:
 upgrade -f <yaml-file-path>
-upgrade -t <upgrade type> -v <version> -f <yaml-file-path>  # Version must be in the format of <00.00.00>
+upgrade -t <component> -v <version> -f <yaml-file-path>  # Version must be in the format of <00.00.00>
+upgrade -t <component> -f <yaml-file-path> --template --render-only
+
+-t takes a component name such as navigation, ignoring case, or its upgrade
+type number. Each server defines its components; "get components" lists them.
+
+With --template the yaml file is a Go template rendered per cluster like
+apply. --render-only prints it instead of upgrading. --resolve-arch and --image-map
+select the image per node architecture like apply.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		images, err := loadImageMap()
+		if err != nil {
+			log.Printf("Failed to load image map: %v\n", err)
+			return
+		}
+		if renderOnly {
+			renderManifests(cmd, upgradeYamlPath, false, images)
+			return
+		}
+
 		fmt.Printf("Apply: %s\n", upgradeYamlPath)
 		fmt.Println()
 
@@ -33,8 +52,25 @@ upgrade -t <upgrade type> -v <version> -f <yaml-file-path>  # Version must be in
 			wg.Add(1)
 			go func(cluster model.Cluster) {
 				defer wg.Done()
-				yamlCon := controller.NewYaml(&cluster.Host, &cluster.Port)
-				err := yamlCon.UpgradeYaml(&upgradeType, &upgradeVersion, &upgradeYamlPath, &cluster)
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				upgradeCon, err := controller.NewUpgrade(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				upgradeType, err := upgradeCon.ComponentType(ctx, upgradeComponent)
+				if err != nil {
+					fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Printf("  %v\n", err)
+					return
+				}
+				yamlCon, err := controller.NewYaml(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				err = yamlCon.UpgradeYaml(ctx, &upgradeType, &upgradeVersion, &upgradeYamlPath, templated, images, &cluster)
 				if err != nil {
 					return
 				}
@@ -51,9 +87,13 @@ func init() {
 	today := time.Now()
 	defaultVer := fmt.Sprintf("%d.%d.%d", today.Year()%100, today.Month(), today.Day())
 
-	upgradeCmd.Flags().IntVarP(&upgradeType, "type", "t", 0, "Upgrade type 0: Micom Manager, 1: Device Bringup, 2: Navigation, 3: Middleware")
+	upgradeCmd.Flags().StringVarP(&upgradeComponent, "type", "t", "", "The component to upgrade, by name or upgrade type number")
 	upgradeCmd.Flags().StringVarP(&upgradeVersion, "version", "v", defaultVer, "Upgrade version")
 	upgradeCmd.Flags().StringVarP(&upgradeYamlPath, "file", "f", "", "The yaml file path")
+	upgradeCmd.Flags().BoolVar(&resolveArch, "resolve-arch", false, "Use the image built for the architecture of each cluster's nodes")
+	upgradeCmd.Flags().StringVar(&imageMapPath, "image-map", "", "The file mapping images to their image per architecture")
+	upgradeCmd.Flags().BoolVar(&templated, "template", false, "Render the yaml file as a Go template with the vars of each cluster")
+	upgradeCmd.Flags().BoolVar(&renderOnly, "render-only", false, "Print the manifest rendered for each cluster without upgrading")
 
 	upgradeCmd.MarkFlagRequired("type")
 	upgradeCmd.MarkFlagRequired("file")
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+var (
+	historyComponent string
+	historySince     time.Duration
+	historyUntil     time.Duration
+	historyLimit     int
+	historyOutput    string
+)
+
+// historyRecord is one version record in the exported history.
+type historyRecord struct {
+	Time      *time.Time `json:"time"`
+	Cluster   string     `json:"cluster"`
+	Component string     `json:"component"`
+	Version   string     `json:"version"`
+	Action    string     `json:"action"`
+}
+
+// upgradeHistoryCmd represents the upgrade history command
+var upgradeHistoryCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show the component versions upgraded on all clusters as one timeline",
+	Long: `Show the component versions upgraded on all clusters, merged into one
+	timeline, oldest first. Records written before servers stored the upgrade
+	time have none and come first. ACTION says whether a record is an upgrade
+	or a rollback.
+
+	-t takes a component name or an upgrade type number.
+	-o json and -o csv export the timeline instead of printing a table.
+
+	For example:
+	upgrade history
+	upgrade history -t navigation --since 720h
+	upgrade history -o csv > history.csv`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if historyOutput != "table" && historyOutput != "json" && historyOutput != "csv" {
+			return fmt.Errorf("unsupported output %q, want table, json or csv", historyOutput)
+		}
+
+		request := &pb.GetUpgradeHistoryRequest{
+			Component: historyComponent,
+			Limit:     int32(historyLimit),
+		}
+		if historySince > 0 {
+			request.Since = timestamppb.New(time.Now().Add(-historySince))
+		}
+		if historyUntil > 0 {
+			request.Until = timestamppb.New(time.Now().Add(-historyUntil))
+		}
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			records []historyRecord
+		)
+		for _, cluster := range clusters.Cluster {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				upgradeCon, err := controller.NewUpgrade(&cluster)
+				if err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					// keep exports parseable
+					fmt.Fprintf(os.Stderr, "Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Fprintf(os.Stderr, "  Failed to connect: %v\n\n", err)
+					return
+				}
+				clusterRecords, err := upgradeCon.GetUpgradeHistory(ctx, request, &cluster)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					// keep exports parseable
+					fmt.Fprintf(os.Stderr, "Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Fprintf(os.Stderr, "  Failed to get upgrade history: %v\n\n", err)
+					return
+				}
+				for _, record := range clusterRecords {
+					entry := historyRecord{
+						Cluster:   cluster.Name,
+						Component: record.Component,
+						Version:   record.Version,
+						Action:    record.Action,
+					}
+					if record.UpdatedAt != nil {
+						updatedAt := record.UpdatedAt.AsTime()
+						entry.Time = &updatedAt
+					}
+					records = append(records, entry)
+				}
+			}(cluster)
+		}
+		wg.Wait()
+
+		sort.SliceStable(records, func(i, j int) bool {
+			if records[i].Time == nil || records[j].Time == nil {
+				return records[i].Time == nil && records[j].Time != nil
+			}
+			if !records[i].Time.Equal(*records[j].Time) {
+				return records[i].Time.Before(*records[j].Time)
+			}
+			return records[i].Cluster < records[j].Cluster
+		})
+
+		if historyLimit > 0 && len(records) > historyLimit {
+			records = records[len(records)-historyLimit:]
+		}
+
+		return writeHistory(os.Stdout, records, historyOutput)
+	},
+}
+
+// writeHistory prints records as a table, JSON or CSV.
+func writeHistory(out io.Writer, records []historyRecord, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if records == nil {
+			records = []historyRecord{}
+		}
+		return encoder.Encode(records)
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"time", "cluster", "component", "version", "action"})
+		for _, record := range records {
+			updatedAt := ""
+			if record.Time != nil {
+				updatedAt = record.Time.UTC().Format(time.RFC3339)
+			}
+			w.Write([]string{updatedAt, record.Cluster, record.Component, record.Version, record.Action})
+		}
+		w.Flush()
+		return w.Error()
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tCLUSTER\tCOMPONENT\tVERSION\tACTION")
+	for _, record := range records {
+		updatedAt := "-"
+		if record.Time != nil {
+			updatedAt = record.Time.Local().Format(time.DateTime)
+		}
+		action := record.Action
+		if action == "" {
+			action = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", updatedAt, record.Cluster, record.Component, record.Version, action)
+	}
+	return w.Flush()
+}
+
+func init() {
+	upgradeCmd.AddCommand(upgradeHistoryCmd)
+
+	upgradeHistoryCmd.Flags().StringVarP(&historyComponent, "type", "t", "", "Only show this component, by name or upgrade type number")
+	upgradeHistoryCmd.Flags().DurationVar(&historySince, "since", 0, "Only show upgrades newer than this, e.g. 720h")
+	upgradeHistoryCmd.Flags().DurationVar(&historyUntil, "until", 0, "Only show upgrades older than this, e.g. 24h")
+	upgradeHistoryCmd.Flags().IntVarP(&historyLimit, "limit", "l", 100, "Maximum number of records, 0 for all")
+	upgradeHistoryCmd.Flags().StringVarP(&historyOutput, "output", "o", "table", "Output format: table, json or csv")
+}
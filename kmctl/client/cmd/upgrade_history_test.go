@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHistory(t *testing.T) {
+	updatedAt := time.Date(2024, 12, 3, 9, 30, 0, 0, time.UTC)
+	records := []historyRecord{
+		{Cluster: "robot-02", Component: "NAVIGATION", Version: "24.11.0"},
+		{Time: &updatedAt, Cluster: "robot-01", Component: "NAVIGATION", Version: "24.12.3", Action: "rollback"},
+	}
+
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"csv", "time,cluster,component,version,action\n,robot-02,NAVIGATION,24.11.0,\n2024-12-03T09:30:00Z,robot-01,NAVIGATION,24.12.3,rollback\n"},
+		{"json", `[
+  {
+    "time": null,
+    "cluster": "robot-02",
+    "component": "NAVIGATION",
+    "version": "24.11.0",
+    "action": ""
+  },
+  {
+    "time": "2024-12-03T09:30:00Z",
+    "cluster": "robot-01",
+    "component": "NAVIGATION",
+    "version": "24.12.3",
+    "action": "rollback"
+  }
+]
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.output, func(t *testing.T) {
+			var out strings.Builder
+			if err := writeHistory(&out, records, tt.output); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("%s =\n%s\nwant\n%s", tt.output, out.String(), tt.want)
+			}
+		})
+	}
+
+	var out strings.Builder
+	writeHistory(&out, nil, "json")
+	if out.String() != "[]\n" {
+		t.Errorf("empty json = %q, want []", out.String())
+	}
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+)
+
+var rollbackToVersion string
+
+// upgradeRollbackCmd represents the upgrade rollback command
+var upgradeRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Roll a component back to an earlier version on all clusters",
+	Long: `Roll a component back to an earlier version on all clusters, without the
+	yaml file of that version. Each server re-applies the manifest it stored
+	when the version was upgraded, or restores the live state it stored before
+	the version was replaced, and records the rollback as a new version.
+
+	-t takes a component name or upgrade type number like upgrade. Without
+	--to-version the component goes back to the version before its current one.
+
+	For example:
+	upgrade rollback -t navigation
+	upgrade rollback -t navigation --to-version 24.12.1`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var wg sync.WaitGroup
+		for _, cluster := range clusters.Cluster {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				upgradeCon, err := controller.NewUpgrade(&cluster)
+				if err != nil {
+					printConnectError(&cluster, err)
+					return
+				}
+				upgradeType, err := upgradeCon.ComponentType(ctx, upgradeComponent)
+				if err != nil {
+					fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Printf("  %v\n", err)
+					return
+				}
+				if err := upgradeCon.RollbackUpgrade(ctx, &upgradeType, &rollbackToVersion, &cluster); err != nil {
+					return
+				}
+				fmt.Println()
+			}(cluster)
+		}
+		wg.Wait()
+	},
+}
+
+func init() {
+	upgradeCmd.AddCommand(upgradeRollbackCmd)
+
+	upgradeRollbackCmd.Flags().StringVarP(&upgradeComponent, "type", "t", "", "The component to roll back, by name or upgrade type number")
+	upgradeRollbackCmd.Flags().StringVar(&rollbackToVersion, "to-version", "", "The version to roll back to, by default the one before the current version")
+
+	upgradeRollbackCmd.MarkFlagRequired("type")
+}
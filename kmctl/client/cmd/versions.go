@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+)
+
+var versionsTargetPath string
+
+// versionsCmd represents the versions command
+var versionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "Show the component versions of all clusters as a matrix",
+	Long: `Show the latest upgraded version of every component on all clusters as a
+	cluster x component matrix. Components never upgraded on a cluster show the
+	image tag version of their Deployments.
+
+	A version marked with * is behind the fleet maximum of its component, or
+	behind the target version when --target names one. The target file maps
+	component names to versions:
+
+	NAVIGATION: 24.12.3
+	MIDDLEWARE: 24.12.0
+
+	For example:
+	versions
+	versions --target release-24.12.yaml`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		target, err := loadTargetVersions(versionsTargetPath)
+		if err != nil {
+			return err
+		}
+
+		var (
+			wg         sync.WaitGroup
+			mu         sync.Mutex
+			components []string
+			matrix     = map[string]map[string]string{}
+		)
+		for _, cluster := range clusters.Cluster {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+				upgradeCon, err := controller.NewUpgrade(&cluster)
+				if err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					printConnectError(&cluster, err)
+					return
+				}
+				versions, err := upgradeCon.GetComponentVersions(ctx, &cluster)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+					fmt.Printf("  Failed to get component versions: %v\n\n", err)
+					return
+				}
+				row := map[string]string{}
+				for _, version := range versions {
+					if !slices.Contains(components, version.Name) {
+						components = append(components, version.Name)
+					}
+					row[version.Name] = version.Version
+				}
+				matrix[cluster.Name] = row
+			}(cluster)
+		}
+		wg.Wait()
+
+		names := make([]string, 0, len(matrix))
+		for name := range matrix {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		references := referenceVersions(matrix, components, target)
+		reference := "FLEET MAX"
+		if len(target) > 0 {
+			reference = "TARGET"
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "CLUSTER\t%s\n", strings.Join(components, "\t"))
+		behind := 0
+		for _, name := range names {
+			cells := make([]string, 0, len(components))
+			clusterBehind := false
+			for _, component := range components {
+				version := matrix[name][component]
+				cell := version
+				if cell == "" {
+					cell = "-"
+				}
+				if versionBehind(version, references[component]) {
+					cell += " *"
+					clusterBehind = true
+				}
+				cells = append(cells, cell)
+			}
+			if clusterBehind {
+				behind++
+			}
+			fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(cells, "\t"))
+		}
+		cells := make([]string, 0, len(components))
+		for _, component := range components {
+			cells = append(cells, cmp.Or(references[component], "-"))
+		}
+		fmt.Fprintf(w, "%s\t%s\n", reference, strings.Join(cells, "\t"))
+		w.Flush()
+
+		fmt.Println()
+		fmt.Printf("%d of %d clusters behind the %s (*)\n", behind, len(names), strings.ToLower(reference))
+
+		return nil
+	},
+}
+
+// loadTargetVersions reads the component versions of a target file, keyed
+// by upper case component name.
+func loadTargetVersions(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions map[string]string
+	if err := yaml.Unmarshal(data, &versions); err != nil {
+		return nil, fmt.Errorf("invalid target file %s: %w", path, err)
+	}
+
+	target := make(map[string]string, len(versions))
+	for component, version := range versions {
+		if _, err := parseVersion(version); err != nil {
+			return nil, fmt.Errorf("invalid target version of %s: %w", component, err)
+		}
+		target[strings.ToUpper(component)] = version
+	}
+
+	return target, nil
+}
+
+// referenceVersions returns the version each component is compared with:
+// its target version, or the highest version of the fleet.
+func referenceVersions(matrix map[string]map[string]string, components []string, target map[string]string) map[string]string {
+	references := map[string]string{}
+	for _, component := range components {
+		if version, ok := target[component]; ok {
+			references[component] = version
+			continue
+		}
+		for _, row := range matrix {
+			if versionBehind(references[component], row[component]) {
+				references[component] = row[component]
+			}
+		}
+	}
+
+	return references
+}
+
+// versionBehind reports whether version is older than reference. A missing
+// version is behind any reference.
+func versionBehind(version, reference string) bool {
+	if reference == "" {
+		return false
+	}
+	if version == "" {
+		return true
+	}
+
+	v, err := parseVersion(version)
+	if err != nil {
+		return false
+	}
+	r, err := parseVersion(reference)
+	if err != nil {
+		return false
+	}
+
+	return slices.Compare(v, r) < 0
+}
+
+// parseVersion splits a <major>.<minor>.<patch> version into numbers.
+func parseVersion(version string) ([]int, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("version %q must be in the format of <00.00.00>", version)
+	}
+
+	numbers := make([]int, 0, len(parts))
+	for _, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("version %q must be in the format of <00.00.00>", version)
+		}
+		numbers = append(numbers, number)
+	}
+
+	return numbers, nil
+}
+
+func init() {
+	rootCmd.AddCommand(versionsCmd)
+
+	versionsCmd.Flags().StringVar(&versionsTargetPath, "target", "", "The file mapping components to their target version")
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import "testing"
+
+func TestVersionBehind(t *testing.T) {
+	tests := []struct {
+		version   string
+		reference string
+		behind    bool
+	}{
+		{"24.12.3", "24.12.3", false},
+		{"24.12.3", "24.12.10", true},
+		{"24.12.10", "24.12.3", false},
+		{"23.12.9", "24.1.0", true},
+		{"", "24.1.0", true},
+		{"24.1.0", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		if behind := versionBehind(tt.version, tt.reference); behind != tt.behind {
+			t.Errorf("versionBehind(%q, %q) = %v, want %v", tt.version, tt.reference, behind, tt.behind)
+		}
+	}
+}
+
+func TestReferenceVersions(t *testing.T) {
+	matrix := map[string]map[string]string{
+		"robot-01": {"NAVIGATION": "24.12.10", "MIDDLEWARE": ""},
+		"robot-02": {"NAVIGATION": "24.12.9", "MIDDLEWARE": "24.10.1"},
+	}
+	components := []string{"NAVIGATION", "MIDDLEWARE", "MICOM_MANAGER"}
+
+	references := referenceVersions(matrix, components, nil)
+	if references["NAVIGATION"] != "24.12.10" || references["MIDDLEWARE"] != "24.10.1" || references["MICOM_MANAGER"] != "" {
+		t.Errorf("fleet max = %v", references)
+	}
+
+	references = referenceVersions(matrix, components, map[string]string{"NAVIGATION": "25.1.0"})
+	if references["NAVIGATION"] != "25.1.0" || references["MIDDLEWARE"] != "24.10.1" {
+		t.Errorf("with target = %v", references)
+	}
+}
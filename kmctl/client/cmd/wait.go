@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+var (
+	waitFor       string
+	waitNamespace string
+	waitSelector  string
+)
+
+// waitCmd represents the wait command
+var waitCmd = &cobra.Command{
+	Use:   "wait <kind>/<name> | <kind> -l <selector>",
+	Short: "Wait until objects meet a condition on all Kubernetes clusters",
+	Long: `Wait until objects meet a condition on all Kubernetes clusters.
+
+	--for is one of:
+	  condition=<type>[=<status>]  a status condition, e.g. condition=Ready
+	  delete                       the objects are deleted
+	  jsonpath={<path>}[=<value>]  a field, e.g. jsonpath={.status.phase}=Running
+	With a selector every matching object must meet the condition. The timeout of
+	each cluster, or --timeout when it has none or is given, is how long to wait
+	on that cluster. kmctl exits with an error when the
+	condition was not met on some cluster.
+
+	Kinds are pod, deployment, service and node.
+
+	For example:
+	wait pod -l app=navigation -s robot --for condition=Ready --timeout 5m
+	wait deployment/navigation -s robot --for condition=Available
+	wait pod/navigation-0 -s robot --for delete`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		kind, name, _ := strings.Cut(args[0], "/")
+		if name == "" && waitSelector == "" {
+			return fmt.Errorf("wait needs <kind>/<name> or a selector")
+		}
+		if name != "" && waitSelector != "" {
+			return fmt.Errorf("wait takes either <kind>/<name> or a selector, not both")
+		}
+
+		request := &pb.WaitRequest{
+			Kind:      kind,
+			Name:      name,
+			Namespace: waitNamespace,
+			Selector:  waitSelector,
+			Condition: waitFor,
+		}
+
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			met      []string
+			timedOut []string
+			failed   []string
+		)
+		for _, cluster := range clusters.Cluster {
+			wg.Add(1)
+			go func(cluster model.Cluster) {
+				defer wg.Done()
+				ctx, cancel := clusterContext(cmd, &cluster)
+				defer cancel()
+
+				waitCon, err := controller.NewWait(&cluster)
+				if err != nil {
+					mu.Lock()
+					defer mu.Unlock()
+					failed = append(failed, fmt.Sprintf("%s (%v)", cluster.Name, err))
+					return
+				}
+				last, err := waitCon.Wait(ctx, request, &cluster, func(event *pb.WaitEvent) {
+					mu.Lock()
+					defer mu.Unlock()
+					fmt.Printf("[%s] %s\n", cluster.Name, event.State)
+				})
+
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case err == nil && last != nil && last.Met:
+					met = append(met, cluster.Name)
+				case status.Code(err) == codes.DeadlineExceeded:
+					state := "no state"
+					if last != nil {
+						state = last.State
+					}
+					timedOut = append(timedOut, fmt.Sprintf("%s (%s)", cluster.Name, state))
+				case err != nil:
+					failed = append(failed, fmt.Sprintf("%s (%s)", cluster.Name, status.Convert(err).Message()))
+				default:
+					failed = append(failed, fmt.Sprintf("%s (stream ended before the condition was met)", cluster.Name))
+				}
+			}(cluster)
+		}
+		wg.Wait()
+
+		sort.Strings(met)
+		sort.Strings(timedOut)
+		sort.Strings(failed)
+
+		fmt.Println()
+		fmt.Printf("Condition met: %s\n", strings.Join(met, ", "))
+		if len(timedOut) > 0 {
+			fmt.Printf("Timed out: %s\n", strings.Join(timedOut, ", "))
+		}
+		if len(failed) > 0 {
+			fmt.Printf("Failed: %s\n", strings.Join(failed, ", "))
+		}
+
+		if len(met) < len(clusters.Cluster) {
+			return fmt.Errorf("%s not met on %d of %d clusters", waitFor, len(clusters.Cluster)-len(met), len(clusters.Cluster))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(waitCmd)
+
+	waitCmd.Flags().StringVar(&waitFor, "for", "", "The condition to wait for: condition=<type>[=<status>], delete or jsonpath={<path>}[=<value>]")
+	waitCmd.Flags().StringVarP(&waitNamespace, "namespace", "s", "default", "The namespace of the objects")
+	waitCmd.Flags().StringVarP(&waitSelector, "selector", "l", "", "Wait for every object matching this label selector")
+	waitCmd.MarkFlagRequired("for")
+}
@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+// ArchImagesAnnotation prefixes the annotation declaring the images of one
+// container per architecture, e.g.
+// images.kube-backend/navigation: "arm64=navigation:24.12.3-arm64,amd64=navigation:24.12.3".
+const ArchImagesAnnotation = "images.kube-backend/"
+
+// ImageMap maps an image in a manifest to its image per architecture. An
+// empty ImageMap resolves the annotations only.
+type ImageMap struct {
+	Images map[string]map[string]string `yaml:"images"`
+}
+
+// LoadImageMap reads a mapping file:
+//
+//	images:
+//	  registry.local/navigation:24.12.3:
+//	    arm64: registry.local/navigation:24.12.3-arm64
+//	    amd64: registry.local/navigation:24.12.3-amd64
+func LoadImageMap(path string) (*ImageMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	images := &ImageMap{}
+	if err := yaml.Unmarshal(data, images); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return images, nil
+}
+
+// NodeArchs returns the distinct architectures of the cluster's nodes.
+func (c *YamlController) NodeArchs(ctx context.Context, cluster *model.Cluster) ([]string, error) {
+	nodeList, err := c.client.GetNodes(ctx, &pb.GetNodesRequest{Cluster: cluster.Context})
+	if err != nil {
+		return nil, err
+	}
+
+	var archs []string
+	for _, node := range nodeList.Nodes {
+		if node.Arch != "" && !slices.Contains(archs, node.Arch) {
+			archs = append(archs, node.Arch)
+		}
+	}
+	slices.Sort(archs)
+
+	return archs, nil
+}
+
+// ResolveArchImages sets the image of every container that declares images
+// per architecture to the one built for archs. The annotation of a container
+// wins over the mapping file. It refuses a container with no image for one
+// of archs, or with different images when the nodes mix architectures.
+func ResolveArchImages(manifest string, archs []string, images *ImageMap) (string, error) {
+	if len(archs) == 0 {
+		return "", fmt.Errorf("the cluster's node architecture is unknown")
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(manifest))
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+
+	for {
+		document := map[string]interface{}{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if len(document) == 0 {
+			continue
+		}
+
+		if err := resolveDocument(document, archs, images); err != nil {
+			return "", err
+		}
+		if err := encoder.Encode(document); err != nil {
+			return "", err
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func resolveDocument(document map[string]interface{}, archs []string, images *ImageMap) error {
+	kind, _ := document["kind"].(string)
+	metadata, _ := document["metadata"].(map[string]interface{})
+	name, _ := metadata["name"].(string)
+
+	annotations := map[string]string{}
+	collectAnnotations(metadata, annotations)
+
+	podSpec, template := podSpecOf(document)
+	if podSpec == nil {
+		return nil
+	}
+	collectAnnotations(template, annotations)
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := podSpec[field].([]interface{})
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			containerName, _ := container["name"].(string)
+			image, _ := container["image"].(string)
+
+			candidates, err := archCandidates(annotations[ArchImagesAnnotation+containerName], image, images)
+			if err != nil {
+				return fmt.Errorf("%s/%s container %s: %w", kind, name, containerName, err)
+			}
+			if candidates == nil {
+				continue
+			}
+
+			resolved := ""
+			for _, arch := range archs {
+				archImage, ok := candidates[arch]
+				if !ok {
+					return fmt.Errorf("%s/%s container %s: no image for %s nodes (%s)", kind, name, containerName, arch, image)
+				}
+				if resolved != "" && resolved != archImage {
+					return fmt.Errorf("%s/%s container %s: nodes are %s but the images differ", kind, name, containerName, strings.Join(archs, ", "))
+				}
+				resolved = archImage
+			}
+			container["image"] = resolved
+		}
+	}
+
+	return nil
+}
+
+func collectAnnotations(metadata map[string]interface{}, annotations map[string]string) {
+	values, _ := metadata["annotations"].(map[string]interface{})
+	for key, value := range values {
+		if s, ok := value.(string); ok && strings.HasPrefix(key, ArchImagesAnnotation) {
+			annotations[key] = s
+		}
+	}
+}
+
+// podSpecOf returns the pod spec of a Pod or a workload, and the metadata of
+// its pod template.
+func podSpecOf(document map[string]interface{}) (map[string]interface{}, map[string]interface{}) {
+	spec, _ := document["spec"].(map[string]interface{})
+	if document["kind"] == "Pod" {
+		return spec, nil
+	}
+	if document["kind"] == "CronJob" {
+		jobTemplate, _ := spec["jobTemplate"].(map[string]interface{})
+		spec, _ = jobTemplate["spec"].(map[string]interface{})
+	}
+
+	template, _ := spec["template"].(map[string]interface{})
+	podSpec, _ := template["spec"].(map[string]interface{})
+	metadata, _ := template["metadata"].(map[string]interface{})
+
+	return podSpec, metadata
+}
+
+// archCandidates parses the annotation "arm64=image,amd64=image", or looks
+// the image up in the mapping file. It returns nil when neither declares it.
+func archCandidates(annotation, image string, images *ImageMap) (map[string]string, error) {
+	if annotation == "" {
+		if images == nil {
+			return nil, nil
+		}
+		return images.Images[image], nil
+	}
+
+	candidates := map[string]string{}
+	for _, entry := range strings.Split(annotation, ",") {
+		arch, archImage, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || arch == "" || archImage == "" {
+			return nil, fmt.Errorf("invalid %s annotation %q, want arch=image", ArchImagesAnnotation, entry)
+		}
+		candidates[arch] = archImage
+	}
+
+	return candidates, nil
+}
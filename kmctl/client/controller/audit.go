@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+type AuditController struct {
+	client pb.KubeBackendClient
+}
+
+func NewAudit(cluster *model.Cluster) (*AuditController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuditController{
+		client: *client,
+	}, nil
+}
+
+// GetAuditLog fetches the entries of the cluster's context, or of the
+// server's default context when the cluster has none.
+func (c *AuditController) GetAuditLog(ctx context.Context, request *pb.GetAuditLogRequest, cluster *model.Cluster) ([]*pb.AuditEntry, error) {
+	request = proto.Clone(request).(*pb.GetAuditLogRequest)
+	request.Cluster = cluster.Context
+
+	auditLog, err := c.client.GetAuditLog(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return auditLog.Entries, nil
+}
@@ -1,25 +1,113 @@
 package controller
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"log"
+	"os"
 
+	"com.kubebackend/m/client/model"
 	pb "com.kubebackend/m/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
-func GetClient(host, port *string) *pb.KubeBackendClient {
-	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// DialOptions are added to every connection, e.g. a dialer for in-memory
+// test servers.
+var DialOptions []grpc.DialOption
 
-	addr := fmt.Sprintf("%s:%s", *host, *port)
+// GetClient connects to the server of cluster. An error means the cluster's
+// settings are invalid, so only that cluster is skipped.
+func GetClient(cluster *model.Cluster) (*pb.KubeBackendClient, error) {
+	opts := append([]grpc.DialOption{}, DialOptions...)
+
+	creds, err := transportCredentials(&cluster.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS config: %w", err)
+	}
+	opts = append(opts, grpc.WithTransportCredentials(creds))
+
+	if token := cluster.BearerToken(); token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&tokenCredentials{
+			token:      token,
+			requireTLS: cluster.TLS.IsEnabled(),
+		}))
+	}
+
+	addr := fmt.Sprintf("%s:%s", cluster.Host, cluster.Port)
 	conn, err := grpc.NewClient(addr, opts...)
 	if err != nil {
-		log.Printf("Failed to connect to server: %v\n", err)
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
 	}
 
 	client := pb.NewKubeBackendClient(conn)
 
-	return &client
+	return &client, nil
+}
+
+// printCallError explains calls that timed out or were cancelled, and
+// prints message for every other error.
+func printCallError(err error, message string) {
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		fmt.Println("  Timed out waiting for the server")
+	case codes.Canceled:
+		fmt.Println("  Cancelled")
+	default:
+		fmt.Printf("  %s\n", message)
+	}
+}
+
+// tokenCredentials sends a bearer token with every RPC. Plaintext connections
+// are allowed so that tokens also work on trusted networks without TLS.
+type tokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+func (t *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t *tokenCredentials) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
+
+func transportCredentials(config *model.TLS) (credentials.TransportCredentials, error) {
+	if !config.IsEnabled() {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if config.CA != "" {
+		pem, err := os.ReadFile(config.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
 }
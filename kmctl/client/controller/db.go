@@ -1,17 +1,13 @@
 package controller
 
 import (
+	"fmt"
 	"log"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-)
-
-const (
-	MicomManager  = "MICOM_MANAGER"
-	DeviceBringup = "DEVICE_BRINGUP"
-	Navigation    = "NAVIGATION"
-	Middleware    = "MIDDLEWARE"
+	"gorm.io/gorm/clause"
 )
 
 type Repo struct {
@@ -21,7 +17,68 @@ type Repo struct {
 	Ver_major   int
 	Ver_minor_1 int
 	Ver_minor_2 int
-	Updated_at  string
+	Updated_at  time.Time
+	// Cluster is the context upgraded, empty for records of older servers
+	Cluster string `gorm:"index"`
+	// Action is "upgrade" or "rollback". Manifest is what was applied and
+	// Previous the JSON snapshot of its objects before. All are empty for
+	// records of older servers.
+	Action        string
+	Manifest      string
+	Manifest_hash string
+	Previous      string
+}
+
+// Audit is one mutating RPC handled by the server.
+type Audit struct {
+	Id           int
+	Caller       string `gorm:"index"`
+	Cluster      string `gorm:"index"`
+	Peer_addr    string
+	Method       string `gorm:"index"`
+	Request_hash string
+	Objects      string
+	Result       string
+	Error        string
+	Duration_ms  int64
+	Created_at   time.Time `gorm:"index"`
+}
+
+// Inventory is the last apply of one object to a cluster through the server.
+type Inventory struct {
+	Id            int
+	Cluster       string `gorm:"uniqueIndex:idx_inventory_object"`
+	Kind          string `gorm:"uniqueIndex:idx_inventory_object"`
+	Namespace     string `gorm:"uniqueIndex:idx_inventory_object"`
+	Name          string `gorm:"uniqueIndex:idx_inventory_object"`
+	Manifest_hash string
+	Applied_by    string
+	Source        string
+	Apply_set     string
+	Applied_at    time.Time
+}
+
+type InventoryFilter struct {
+	Cluster   string
+	Kind      string
+	Namespace string
+	ApplySet  string
+}
+
+type RepoFilter struct {
+	Clusters []string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+}
+
+type AuditFilter struct {
+	Caller  string
+	Method  string
+	Cluster string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
 }
 
 type DBController struct {
@@ -29,19 +86,51 @@ type DBController struct {
 }
 
 func NewDB(path *string) *DBController {
-	db, err := gorm.Open(sqlite.Open(*path), &gorm.Config{})
+	dbCon, err := OpenDB(path)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 
-	db.AutoMigrate(&Repo{})
+	return dbCon
+}
+
+// OpenDB is like NewDB but returns the error instead of exiting.
+func OpenDB(path *string) (*DBController, error) {
+	db, err := gorm.Open(sqlite.Open(*path), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.AutoMigrate(&Repo{}, &Audit{}, &Inventory{}); err != nil {
+		return nil, err
+	}
+
 	return &DBController{
 		db: db,
+	}, nil
+}
+
+// MigrateRepoTables creates the version table of every component. Rows
+// older servers stored with the literal "CURRENT_TIMESTAMP" as Updated_at
+// lose it, since it never held a time, and get an empty Cluster.
+func (c *DBController) MigrateRepoTables(tables []string) error {
+	for _, table := range tables {
+		if err := c.db.Table(table).AutoMigrate(&Repo{}); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		if err := c.db.Table(table).Where("updated_at = ?", "CURRENT_TIMESTAMP").Update("updated_at", nil).Error; err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		if err := c.db.Table(table).Where("cluster IS NULL").Update("cluster", "").Error; err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
 	}
+
+	return nil
 }
 
-func (c *DBController) InsertRepo(updateType *string, repo *Repo) {
-	c.db.Table(*updateType).Create(repo)
+func (c *DBController) InsertRepo(updateType *string, repo *Repo) error {
+	return c.db.Table(*updateType).Create(repo).Error
 }
 
 func (c *DBController) UpdateRepo(updateType *string, repo *Repo) {
@@ -60,6 +149,92 @@ func (c *DBController) GetAllRepos(updateType *string, repos *[]Repo) {
 	c.db.Table(*updateType).Find(repos)
 }
 
+// GetLatestRepo loads the most recently inserted record of updateType.
+func (c *DBController) GetLatestRepo(updateType *string, repo *Repo) error {
+	return c.db.Table(*updateType).Order("id desc").First(repo).Error
+}
+
+// GetRepos returns the records of updateType matching filter, newest first.
+func (c *DBController) GetRepos(updateType *string, filter *RepoFilter, repos *[]Repo) error {
+	query := c.db.Table(*updateType).Order("updated_at desc, id desc")
+	if len(filter.Clusters) > 0 {
+		query = query.Where("cluster IN ?", filter.Clusters)
+	}
+	// times are stored in UTC and compared as text
+	if !filter.Since.IsZero() {
+		query = query.Where("updated_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("updated_at <= ?", filter.Until.UTC())
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	return query.Find(repos).Error
+}
+
+func (c *DBController) InsertAudit(audit *Audit) error {
+	return c.db.Create(audit).Error
+}
+
+// GetAudits returns the audit records matching filter, newest first.
+func (c *DBController) GetAudits(filter *AuditFilter, audits *[]Audit) error {
+	query := c.db.Model(&Audit{}).Order("created_at desc")
+	if filter.Caller != "" {
+		query = query.Where("caller = ?", filter.Caller)
+	}
+	if filter.Method != "" {
+		query = query.Where("method = ?", filter.Method)
+	}
+	if filter.Cluster != "" {
+		query = query.Where("cluster = ?", filter.Cluster)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at <= ?", filter.Until)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	return query.Find(audits).Error
+}
+
+// SaveInventory inserts the object, or replaces its previous apply.
+func (c *DBController) SaveInventory(inventory *Inventory) error {
+	return c.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cluster"}, {Name: "kind"}, {Name: "namespace"}, {Name: "name"}},
+		UpdateAll: true,
+	}).Create(inventory).Error
+}
+
+func (c *DBController) DeleteInventory(cluster, kind, namespace, name *string) error {
+	return c.db.Where("cluster = ? AND kind = ? AND namespace = ? AND name = ?", *cluster, *kind, *namespace, *name).Delete(&Inventory{}).Error
+}
+
+// GetInventory returns the objects matching filter ordered by kind,
+// namespace and name.
+func (c *DBController) GetInventory(filter *InventoryFilter, inventory *[]Inventory) error {
+	query := c.db.Model(&Inventory{}).Order("kind, namespace, name")
+	if filter.Cluster != "" {
+		query = query.Where("cluster = ?", filter.Cluster)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	if filter.Namespace != "" {
+		query = query.Where("namespace = ?", filter.Namespace)
+	}
+	if filter.ApplySet != "" {
+		query = query.Where("apply_set = ?", filter.ApplySet)
+	}
+
+	return query.Find(inventory).Error
+}
+
 func (c *DBController) Close() {
 	sqlDB, err := c.db.DB()
 	if err != nil {
@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"com.kubebackend/m/client/model"
 	pb "com.kubebackend/m/proto"
@@ -12,18 +13,23 @@ type GetController struct {
 	client pb.KubeBackendClient
 }
 
-func NewGet(host, port *string) *GetController {
-	return &GetController{
-		client: *GetClient(host, port),
+func NewGet(cluster *model.Cluster) (*GetController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
 	}
+
+	return &GetController{
+		client: *client,
+	}, nil
 }
 
-func (c *GetController) GetNode(name *string, cluster *model.Cluster) {
-	node := &pb.GetNodeRequest{Name: *name}
-	nodeInfo, err := c.client.GetNode(context.Background(), node)
+func (c *GetController) GetNode(ctx context.Context, name *string, cluster *model.Cluster) {
+	node := &pb.GetNodeRequest{Name: *name, Cluster: cluster.Context}
+	nodeInfo, err := c.client.GetNode(ctx, node)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		fmt.Println("  There is no node with that name")
+		printCallError(err, "There is no node with that name")
 		return
 	}
 
@@ -34,12 +40,12 @@ func (c *GetController) GetNode(name *string, cluster *model.Cluster) {
 	fmt.Printf("  Kernel Version: %s\n", nodeInfo.KernelVersion)
 }
 
-func (c *GetController) GetNodes(cluster *model.Cluster) {
-	nodes := &pb.GetNodesRequest{}
-	nodeList, err := c.client.GetNodes(context.Background(), nodes)
+func (c *GetController) GetNodes(ctx context.Context, cluster *model.Cluster) {
+	nodes := &pb.GetNodesRequest{Cluster: cluster.Context}
+	nodeList, err := c.client.GetNodes(ctx, nodes)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		fmt.Println("  There are no nodes")
+		printCallError(err, "There are no nodes")
 		return
 	}
 
@@ -49,12 +55,12 @@ func (c *GetController) GetNodes(cluster *model.Cluster) {
 	}
 }
 
-func (c *GetController) GetPod(name *string, namespace *string, cluster *model.Cluster) {
-	pod := &pb.GetPodRequest{Name: *name, Namespace: *namespace}
-	podInfo, err := c.client.GetPod(context.Background(), pod)
+func (c *GetController) GetPod(ctx context.Context, name *string, namespace *string, cluster *model.Cluster) {
+	pod := &pb.GetPodRequest{Name: *name, Namespace: *namespace, Cluster: cluster.Context}
+	podInfo, err := c.client.GetPod(ctx, pod)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		fmt.Println("  There is no pod with that name")
+		printCallError(err, "There is no pod with that name")
 		return
 	}
 
@@ -66,12 +72,12 @@ func (c *GetController) GetPod(name *string, namespace *string, cluster *model.C
 	fmt.Printf("  Image: %s\n", podInfo.Image)
 }
 
-func (c *GetController) GetPods(namespace *string, cluster *model.Cluster) {
-	pods := &pb.GetPodsRequest{Namespace: *namespace}
-	podList, err := c.client.GetPods(context.Background(), pods)
+func (c *GetController) GetPods(ctx context.Context, namespace *string, cluster *model.Cluster) {
+	pods := &pb.GetPodsRequest{Namespace: *namespace, Cluster: cluster.Context}
+	podList, err := c.client.GetPods(ctx, pods)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		fmt.Println("  There are no pods")
+		printCallError(err, "There are no pods")
 		return
 	}
 
@@ -87,3 +93,57 @@ func (c *GetController) GetPods(namespace *string, cluster *model.Cluster) {
 		fmt.Printf("  %-*s\t%s\n", maxNameLength, pod.Name, pod.Status)
 	}
 }
+
+// GetClusters prints the kubeconfig contexts served by the cluster's server.
+func (c *GetController) GetClusters(ctx context.Context, cluster *model.Cluster) {
+	clusterList, err := c.client.ListClusters(ctx, &pb.ListClustersRequest{})
+	if err != nil {
+		fmt.Printf("Server: %s:%s\n", cluster.Host, cluster.Port)
+		fmt.Printf("  Failed to list clusters: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Server: %s:%s\n", cluster.Host, cluster.Port)
+	maxNameLength := 0
+	for _, info := range clusterList.Clusters {
+		if len(info.Name) > maxNameLength {
+			maxNameLength = len(info.Name)
+		}
+	}
+
+	for _, info := range clusterList.Clusters {
+		name := info.Name
+		if info.Default {
+			name += "*"
+		}
+		state := "Ready"
+		if !info.Ready {
+			state = "NotReady"
+		}
+		fmt.Printf("  %-*s\t%s\t%s\n", maxNameLength+1, name, state, info.Server)
+	}
+}
+
+func (c *GetController) GetComponents(ctx context.Context, cluster *model.Cluster) {
+	list, err := c.client.ListComponents(ctx, &pb.ListComponentsRequest{})
+	if err != nil {
+		fmt.Printf("Server: %s:%s\n", cluster.Host, cluster.Port)
+		fmt.Printf("  Failed to list components: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Server: %s:%s\n", cluster.Host, cluster.Port)
+	maxNameLength, maxDescriptionLength := 0, 0
+	for _, component := range list.Components {
+		maxNameLength = max(maxNameLength, len(component.Name))
+		maxDescriptionLength = max(maxDescriptionLength, len(component.Description))
+	}
+
+	for _, component := range list.Components {
+		deployments := strings.Join(component.Deployments, ",")
+		if deployments == "" {
+			deployments = "-"
+		}
+		fmt.Printf("  %d\t%-*s\t%-*s\t%s\n", component.Type, maxNameLength, component.Name, maxDescriptionLength, component.Description, deployments)
+	}
+}
@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+type InventoryController struct {
+	client pb.KubeBackendClient
+}
+
+func NewInventory(cluster *model.Cluster) (*InventoryController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InventoryController{
+		client: *client,
+	}, nil
+}
+
+// GetInventory fetches the objects applied to the cluster's context, or to
+// the server's default context when the cluster has none.
+func (c *InventoryController) GetInventory(ctx context.Context, request *pb.GetInventoryRequest, cluster *model.Cluster) ([]*pb.InventoryEntry, error) {
+	request = proto.Clone(request).(*pb.GetInventoryRequest)
+	request.Cluster = cluster.Context
+
+	inventory, err := c.client.GetInventory(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory.Entries, nil
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"com.kubebackend/m/client/model"
+)
+
+// KustomizeOverlay returns the kustomization rendered for the cluster:
+// <dir>/overlays/<name> when it exists, then <dir>/overlays/<group>, then
+// dir itself, else <dir>/base.
+func KustomizeOverlay(fSys filesys.FileSystem, dir string, cluster *model.Cluster) string {
+	for _, name := range []string{cluster.Name, cluster.Group} {
+		if name == "" {
+			continue
+		}
+
+		overlay := filepath.Join(dir, "overlays", name)
+		if hasKustomization(fSys, overlay) {
+			return overlay
+		}
+	}
+
+	if base := filepath.Join(dir, "base"); !hasKustomization(fSys, dir) && hasKustomization(fSys, base) {
+		return base
+	}
+
+	return dir
+}
+
+func hasKustomization(fSys filesys.FileSystem, dir string) bool {
+	for _, file := range konfig.RecognizedKustomizationFileNames() {
+		if fSys.Exists(filepath.Join(dir, file)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RenderKustomize builds the cluster's kustomization and returns the
+// multi-document manifest along with the rendered directory.
+func RenderKustomize(dir string, cluster *model.Cluster) (string, string, error) {
+	fSys := filesys.MakeFsOnDisk()
+	overlay := KustomizeOverlay(fSys, dir, cluster)
+
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(fSys, overlay)
+	if err != nil {
+		return "", overlay, fmt.Errorf("failed to build %s: %w", overlay, err)
+	}
+
+	manifest, err := resources.AsYaml()
+	if err != nil {
+		return "", overlay, fmt.Errorf("failed to render %s: %w", overlay, err)
+	}
+
+	return string(manifest), overlay, nil
+}
@@ -10,22 +10,29 @@ import (
 	"com.kubebackend/m/client/model"
 	pb "com.kubebackend/m/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type LogsController struct {
 	client pb.KubeBackendClient
 }
 
-func NewLogs(host, port *string) *LogsController {
-	return &LogsController{
-		client: *GetClient(host, port),
+func NewLogs(cluster *model.Cluster) (*LogsController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
 	}
+
+	return &LogsController{
+		client: *client,
+	}, nil
 }
 
-func (c *LogsController) GetPodLogsStream(name, namespace *string, lastLines *int, cluster *model.Cluster) {
-	podLogs := &pb.GetPodLogsRequest{Name: *name, Namespace: *namespace}
+func (c *LogsController) GetPodLogsStream(ctx context.Context, name, namespace *string, lastLines *int, cluster *model.Cluster) {
+	podLogs := &pb.GetPodLogsRequest{Name: *name, Namespace: *namespace, Cluster: cluster.Context}
 	callOpts := grpc.MaxCallRecvMsgSize(1024 * 1024 * 1024)
-	stream, err := c.client.GetPodLogs(context.Background(), podLogs, callOpts)
+	stream, err := c.client.GetPodLogs(ctx, podLogs, callOpts)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
 		log.Printf("Failed to get pod logs: %v\n", err)
@@ -40,8 +47,11 @@ func (c *LogsController) GetPodLogsStream(name, namespace *string, lastLines *in
 		if err == io.EOF {
 			log.Printf("  End of log stream")
 			break
+		} else if status.Code(err) == codes.Unavailable {
+			fmt.Printf("  Log stream ended: %s\n", status.Convert(err).Message())
+			break
 		} else if err != nil {
-			fmt.Printf("  There is no logs for pod \"%s\" in namespace \"%s\"\n", *name, *namespace)
+			printCallError(err, fmt.Sprintf("There is no logs for pod \"%s\" in namespace \"%s\"", *name, *namespace))
 			break
 		}
 
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+
+	"com.kubebackend/m/client/model"
+)
+
+// TemplateData is what a manifest template sees: {{ .Name }}, {{ .Group }},
+// {{ .Context }} and {{ .Vars.robot_id }}.
+type TemplateData struct {
+	Name    string
+	Group   string
+	Context string
+	Vars    map[string]string
+}
+
+// RenderTemplate executes manifest as a Go template with the cluster's
+// variables. A variable the cluster does not define is an error.
+func RenderTemplate(name, manifest string, cluster *model.Cluster) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(manifest)
+	if err != nil {
+		return "", err
+	}
+
+	vars := cluster.Vars
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	data := TemplateData{
+		Name:    cluster.Name,
+		Group:   cluster.Group,
+		Context: cluster.Context,
+		Vars:    vars,
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// ReadManifest reads the yaml file at path, or builds the cluster's overlay
+// when kustomize is set, and with template renders it for the cluster. It
+// returns the manifest and the file or overlay it came from.
+func ReadManifest(path string, kustomize, template bool, cluster *model.Cluster) (string, string, error) {
+	source := path
+
+	var manifest string
+	if kustomize {
+		var err error
+		manifest, source, err = RenderKustomize(path, cluster)
+		if err != nil {
+			return "", source, err
+		}
+	} else {
+		yamlFile, err := os.ReadFile(path)
+		if err != nil {
+			return "", source, fmt.Errorf("failed to read yaml file: %w", err)
+		}
+		manifest = string(yamlFile)
+	}
+
+	if !template {
+		return manifest, source, nil
+	}
+
+	manifest, err := RenderTemplate(source, manifest, cluster)
+	if err != nil {
+		return "", source, fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return manifest, source, nil
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+type UpgradeController struct {
+	client pb.KubeBackendClient
+}
+
+func NewUpgrade(cluster *model.Cluster) (*UpgradeController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UpgradeController{
+		client: *client,
+	}, nil
+}
+
+// GetUpgradeHistory fetches the version records of the cluster's context, or
+// of the server's default context when the cluster has none, newest first.
+func (c *UpgradeController) GetUpgradeHistory(ctx context.Context, request *pb.GetUpgradeHistoryRequest, cluster *model.Cluster) ([]*pb.UpgradeRecord, error) {
+	request = proto.Clone(request).(*pb.GetUpgradeHistoryRequest)
+	request.Cluster = cluster.Context
+
+	history, err := c.client.GetUpgradeHistory(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return history.Records, nil
+}
+
+// GetComponentVersions fetches the latest version of every component on the
+// cluster's context, or on the server's default context when the cluster has
+// none.
+func (c *UpgradeController) GetComponentVersions(ctx context.Context, cluster *model.Cluster) ([]*pb.ComponentVersion, error) {
+	versions, err := c.client.GetComponentVersions(ctx, &pb.GetComponentVersionsRequest{Cluster: cluster.Context})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions.Components, nil
+}
+
+// RollbackUpgrade puts the component of updateType back to toVersion, or to
+// the version before its latest upgrade when toVersion is empty.
+func (c *UpgradeController) RollbackUpgrade(ctx context.Context, updateType *int, toVersion *string, cluster *model.Cluster) error {
+	request := &pb.RollbackUpgradeRequest{Type: int32(*updateType), ToVersion: *toVersion, Cluster: cluster.Context}
+	resp, err := c.client.RollbackUpgrade(ctx, request)
+	if err != nil {
+		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+		log.Printf("Failed to roll back upgrade: %v\n", err)
+		printUpgradeError("rollback", err)
+		return err
+	}
+
+	fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
+	fmt.Printf("  Rolled back %s -> %s: %s\n", resp.FromVersion, resp.ToVersion, resp.Message)
+
+	return nil
+}
+
+// ListComponents fetches the upgradable components of the cluster's server in
+// configuration order.
+func (c *UpgradeController) ListComponents(ctx context.Context) ([]*pb.Component, error) {
+	list, err := c.client.ListComponents(ctx, &pb.ListComponentsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return list.Components, nil
+}
+
+// ComponentType returns the upgrade type of the component called name on the
+// cluster's server. An upgrade type number is returned as is, so that servers
+// without ListComponents still take it.
+func (c *UpgradeController) ComponentType(ctx context.Context, name string) (int, error) {
+	if upgradeType, err := strconv.Atoi(name); err == nil {
+		return upgradeType, nil
+	}
+
+	components, err := c.ListComponents(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list components: %w", err)
+	}
+
+	return findComponent(components, name)
+}
+
+// findComponent returns the upgrade type of the component called name,
+// ignoring case.
+func findComponent(components []*pb.Component, name string) (int, error) {
+	names := make([]string, 0, len(components))
+	for _, component := range components {
+		if strings.EqualFold(component.Name, name) {
+			return int(component.Type), nil
+		}
+		names = append(names, strings.ToLower(component.Name))
+	}
+
+	return 0, fmt.Errorf("unknown component %q, want one of %s", name, strings.Join(names, ", "))
+}
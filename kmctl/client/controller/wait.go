@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"context"
+	"io"
+
+	"google.golang.org/protobuf/proto"
+
+	"com.kubebackend/m/client/model"
+	pb "com.kubebackend/m/proto"
+)
+
+type WaitController struct {
+	client pb.KubeBackendClient
+}
+
+func NewWait(cluster *model.Cluster) (*WaitController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WaitController{
+		client: *client,
+	}, nil
+}
+
+// Wait blocks until the objects of request meet its condition on the
+// cluster, calling progress with every state the server reports. It returns
+// the last event, and the error of the stream when the condition was not met.
+func (c *WaitController) Wait(ctx context.Context, request *pb.WaitRequest, cluster *model.Cluster, progress func(*pb.WaitEvent)) (*pb.WaitEvent, error) {
+	request = proto.Clone(request).(*pb.WaitRequest)
+	request.Cluster = cluster.Context
+
+	stream, err := c.client.Wait(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	var last *pb.WaitEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return last, err
+		}
+
+		last = event
+		progress(event)
+		if event.Met {
+			return last, nil
+		}
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
 
 	"com.kubebackend/m/client/model"
 	pb "com.kubebackend/m/proto"
@@ -14,22 +17,75 @@ type YamlController struct {
 	client pb.KubeBackendClient
 }
 
-func NewYaml(host, port *string) *YamlController {
+func NewYaml(cluster *model.Cluster) (*YamlController, error) {
+	client, err := GetClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
 	return &YamlController{
-		client: *GetClient(host, port),
+		client: *client,
+	}, nil
+}
+
+// Prune asks the server to delete the objects applied with Selector that the
+// manifest no longer has. ApplySet names the apply set, by default the
+// manifest's source. DryRun only lists them and applies nothing.
+type Prune struct {
+	ApplySet string
+	Selector string
+	Kinds    []string
+	DryRun   bool
+}
+
+func (c *YamlController) ApplyYaml(ctx context.Context, path *string, template bool, images *ImageMap, prune *Prune, cluster *model.Cluster) error {
+	return c.apply(ctx, path, false, template, images, prune, cluster)
+}
+
+// ApplyKustomize renders the cluster's overlay of the kustomization in dir
+// and applies every object in it.
+func (c *YamlController) ApplyKustomize(ctx context.Context, dir *string, template bool, images *ImageMap, prune *Prune, cluster *model.Cluster) error {
+	return c.apply(ctx, dir, true, template, images, prune, cluster)
+}
+
+// RenderManifest reads the manifest for the cluster like ReadManifest. With
+// images, it then sets the images built for the cluster's node architectures.
+func (c *YamlController) RenderManifest(ctx context.Context, path *string, kustomize, template bool, images *ImageMap, cluster *model.Cluster) (string, string, error) {
+	manifest, source, err := ReadManifest(*path, kustomize, template, cluster)
+	if err != nil || images == nil {
+		return manifest, source, err
+	}
+
+	archs, err := c.NodeArchs(ctx, cluster)
+	if err != nil {
+		return "", source, fmt.Errorf("failed to get node architectures: %w", err)
 	}
+
+	manifest, err = ResolveArchImages(manifest, archs, images)
+	if err != nil {
+		return "", source, err
+	}
+
+	return manifest, source, nil
 }
 
-func (c *YamlController) ApplyYaml(path *string, cluster *model.Cluster) error {
-	yamlFile, err := os.ReadFile(*path)
+func (c *YamlController) apply(ctx context.Context, path *string, kustomize, template bool, images *ImageMap, prune *Prune, cluster *model.Cluster) error {
+	manifest, source, err := c.RenderManifest(ctx, path, kustomize, template, images, cluster)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		log.Printf("Failed to read yaml file: %v\n", err)
+		log.Printf("Failed to render yaml: %v\n", err)
 		return err
 	}
 
-	applyYaml := &pb.ApplyYamlRequest{Yaml: string(yamlFile)}
-	_, err = c.client.ApplyYaml(context.Background(), applyYaml)
+	applyYaml := &pb.ApplyYamlRequest{Yaml: manifest, Cluster: cluster.Context, Source: source}
+	if prune != nil {
+		applyYaml.Prune = true
+		applyYaml.ApplySet = prune.ApplySet
+		applyYaml.Selector = prune.Selector
+		applyYaml.PruneKinds = prune.Kinds
+		applyYaml.DryRun = prune.DryRun
+	}
+	response, err := c.client.ApplyYaml(ctx, applyYaml)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
 		log.Printf("Failed to apply yaml: %v\n", err)
@@ -37,21 +93,45 @@ func (c *YamlController) ApplyYaml(path *string, cluster *model.Cluster) error {
 	}
 
 	fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-	fmt.Printf("  Apply Yaml Response: %s\n", *path)
+	if prune != nil && prune.DryRun {
+		fmt.Printf("  Prune Preview: %s\n", source)
+	} else {
+		fmt.Printf("  Apply Yaml Response: %s\n", source)
+	}
+	for _, object := range response.Pruned {
+		if prune.DryRun {
+			fmt.Printf("  Would prune: %s\n", object)
+		} else {
+			fmt.Printf("  Pruned: %s\n", object)
+		}
+	}
+	if prune != nil && len(response.Pruned) == 0 {
+		fmt.Printf("  Nothing to prune\n")
+	}
 
 	return nil
 }
 
-func (c *YamlController) DeleteYaml(path *string, cluster *model.Cluster) error {
-	yamlFile, err := os.ReadFile(*path)
+func (c *YamlController) DeleteYaml(ctx context.Context, path *string, template bool, cluster *model.Cluster) error {
+	return c.delete(ctx, path, false, template, cluster)
+}
+
+// DeleteKustomize renders the cluster's overlay of the kustomization in dir
+// and deletes every object in it.
+func (c *YamlController) DeleteKustomize(ctx context.Context, dir *string, template bool, cluster *model.Cluster) error {
+	return c.delete(ctx, dir, true, template, cluster)
+}
+
+func (c *YamlController) delete(ctx context.Context, path *string, kustomize, template bool, cluster *model.Cluster) error {
+	manifest, source, err := ReadManifest(*path, kustomize, template, cluster)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		log.Printf("Failed to read yaml file: %v\n", err)
+		log.Printf("Failed to render yaml: %v\n", err)
 		return err
 	}
 
-	applyYaml := &pb.ApplyYamlRequest{Yaml: string(yamlFile)}
-	_, err = c.client.DeleteYaml(context.Background(), applyYaml)
+	applyYaml := &pb.ApplyYamlRequest{Yaml: manifest, Cluster: cluster.Context}
+	_, err = c.client.DeleteYaml(ctx, applyYaml)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
 		log.Printf("Failed to delete yaml: %v\n", err)
@@ -59,24 +139,25 @@ func (c *YamlController) DeleteYaml(path *string, cluster *model.Cluster) error
 	}
 
 	fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-	fmt.Printf("  Delete Yaml Response: %s\n", *path)
+	fmt.Printf("  Delete Yaml Response: %s\n", source)
 
 	return nil
 }
 
-func (c *YamlController) UpgradeYaml(updateType *int, version *string, path *string, cluster *model.Cluster) error {
-	yamlFile, err := os.ReadFile(*path)
+func (c *YamlController) UpgradeYaml(ctx context.Context, updateType *int, version *string, path *string, template bool, images *ImageMap, cluster *model.Cluster) error {
+	manifest, _, err := c.RenderManifest(ctx, path, false, template, images, cluster)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
-		log.Printf("Failed to read yaml file: %v\n", err)
+		log.Printf("Failed to render yaml: %v\n", err)
 		return err
 	}
 
-	upgradeYaml := &pb.UpgradeYamlRequest{Yaml: string(yamlFile), Version: *version, Type: int32(*updateType)}
-	_, err = c.client.UpgradeYaml(context.Background(), upgradeYaml)
+	upgradeYaml := &pb.UpgradeYamlRequest{Yaml: manifest, Version: *version, Type: int32(*updateType), Cluster: cluster.Context, Source: *path}
+	_, err = c.client.UpgradeYaml(ctx, upgradeYaml)
 	if err != nil {
 		fmt.Printf("Cluster: %s (%s)\n", cluster.Name, cluster.Host)
 		log.Printf("Failed to upgrade yaml: %v\n", err)
+		printUpgradeError("upgrade", err)
 		return err
 	}
 
@@ -85,3 +166,27 @@ func (c *YamlController) UpgradeYaml(updateType *int, version *string, path *str
 
 	return nil
 }
+
+// upgradeErrorDomain is the ErrorInfo domain of the server's upgrade errors.
+const upgradeErrorDomain = "kube-backend/upgrade"
+
+// printUpgradeError shows which step of an upgrade or rollback failed and
+// whether the server restored the cluster.
+func printUpgradeError(operation string, err error) {
+	for _, detail := range status.Convert(err).Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != upgradeErrorDomain {
+			continue
+		}
+
+		fmt.Printf("  %s failed: %s (%s %s)\n", strings.ToUpper(operation[:1])+operation[1:], info.Reason, info.Metadata["component"], info.Metadata["version"])
+		switch info.Metadata["restored"] {
+		case "true":
+			fmt.Printf("  Cluster restored to its state before the %s\n", operation)
+		case "false":
+			fmt.Printf("  Cluster NOT restored: %s\n", info.Metadata["restoreError"])
+		default:
+			fmt.Println("  Cluster not changed")
+		}
+	}
+}
@@ -1,11 +1,97 @@
 package model
 
+import (
+	"maps"
+	"os"
+	"time"
+)
+
 type Clusters struct {
 	Cluster []Cluster `mapstructure:"server"`
+	Groups  []Group   `mapstructure:"groups"`
+}
+
+// Group holds the template variables shared by the clusters of one group.
+type Group struct {
+	Name string            `mapstructure:"name"`
+	Vars map[string]string `mapstructure:"vars"`
+}
+
+// MergeGroupVars gives every cluster the variables of its group, overridden
+// by the cluster's own.
+func (c *Clusters) MergeGroupVars() {
+	for i := range c.Cluster {
+		cluster := &c.Cluster[i]
+		if cluster.Group == "" {
+			continue
+		}
+
+		vars := map[string]string{}
+		for _, group := range c.Groups {
+			if group.Name == cluster.Group {
+				maps.Copy(vars, group.Vars)
+			}
+		}
+		maps.Copy(vars, cluster.Vars)
+		cluster.Vars = vars
+	}
 }
 
 type Cluster struct {
 	Name string `mapstructure:"name"`
 	Port string `mapstructure:"port"`
 	Host string `mapstructure:"host"`
+	// Context selects one of the kubeconfig contexts served by the server.
+	// The server's default cluster is used when it is empty.
+	Context string `mapstructure:"context"`
+	// Group names the robot model or fleet the cluster belongs to. apply -k
+	// uses overlays/<group> when the cluster has no overlay of its own.
+	Group string `mapstructure:"group"`
+	// Vars are the manifest template variables of the cluster, e.g. robot_id.
+	// Names are lower case since config keys are case-insensitive.
+	Vars     map[string]string `mapstructure:"vars"`
+	TLS      TLS               `mapstructure:"tls"`
+	Token    string            `mapstructure:"token"`
+	TokenEnv string            `mapstructure:"tokenEnv"`
+	// Timeout bounds every call to this cluster, e.g. 10s. Zero uses --timeout.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// DefaultTokenEnv is read when a cluster sets neither token nor tokenEnv.
+const DefaultTokenEnv = "KMCTL_TOKEN"
+
+// BearerToken returns the token sent to the cluster's server. An explicit
+// token wins over tokenEnv, which wins over $KMCTL_TOKEN.
+func (c *Cluster) BearerToken() string {
+	if c.Token != "" {
+		return c.Token
+	}
+	if c.TokenEnv != "" {
+		return os.Getenv(c.TokenEnv)
+	}
+	return os.Getenv(DefaultTokenEnv)
+}
+
+// RequestTimeout returns the cluster's own timeout, or fallback when it has
+// none.
+func (c *Cluster) RequestTimeout(fallback time.Duration) time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return fallback
+}
+
+// TLS holds the per-cluster transport security settings. The connection is
+// plaintext unless at least one of them is set.
+type TLS struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CA                 string `mapstructure:"ca"`
+	Cert               string `mapstructure:"cert"`
+	Key                string `mapstructure:"key"`
+	ServerName         string `mapstructure:"serverName"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+}
+
+func (t *TLS) IsEnabled() bool {
+	return t.Enabled || t.CA != "" || t.Cert != "" || t.ServerName != "" || t.InsecureSkipVerify
 }
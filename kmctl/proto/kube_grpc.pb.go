@@ -19,14 +19,22 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	KubeBackend_GetNodes_FullMethodName    = "/kube.KubeBackend/GetNodes"
-	KubeBackend_GetNode_FullMethodName     = "/kube.KubeBackend/GetNode"
-	KubeBackend_GetPods_FullMethodName     = "/kube.KubeBackend/GetPods"
-	KubeBackend_GetPod_FullMethodName      = "/kube.KubeBackend/GetPod"
-	KubeBackend_GetPodLogs_FullMethodName  = "/kube.KubeBackend/GetPodLogs"
-	KubeBackend_ApplyYaml_FullMethodName   = "/kube.KubeBackend/ApplyYaml"
-	KubeBackend_DeleteYaml_FullMethodName  = "/kube.KubeBackend/DeleteYaml"
-	KubeBackend_UpgradeYaml_FullMethodName = "/kube.KubeBackend/UpgradeYaml"
+	KubeBackend_GetNodes_FullMethodName             = "/kube.KubeBackend/GetNodes"
+	KubeBackend_GetNode_FullMethodName              = "/kube.KubeBackend/GetNode"
+	KubeBackend_GetPods_FullMethodName              = "/kube.KubeBackend/GetPods"
+	KubeBackend_GetPod_FullMethodName               = "/kube.KubeBackend/GetPod"
+	KubeBackend_GetPodLogs_FullMethodName           = "/kube.KubeBackend/GetPodLogs"
+	KubeBackend_ApplyYaml_FullMethodName            = "/kube.KubeBackend/ApplyYaml"
+	KubeBackend_DeleteYaml_FullMethodName           = "/kube.KubeBackend/DeleteYaml"
+	KubeBackend_UpgradeYaml_FullMethodName          = "/kube.KubeBackend/UpgradeYaml"
+	KubeBackend_GetAuditLog_FullMethodName          = "/kube.KubeBackend/GetAuditLog"
+	KubeBackend_ListClusters_FullMethodName         = "/kube.KubeBackend/ListClusters"
+	KubeBackend_GetInventory_FullMethodName         = "/kube.KubeBackend/GetInventory"
+	KubeBackend_GetUpgradeHistory_FullMethodName    = "/kube.KubeBackend/GetUpgradeHistory"
+	KubeBackend_GetComponentVersions_FullMethodName = "/kube.KubeBackend/GetComponentVersions"
+	KubeBackend_RollbackUpgrade_FullMethodName      = "/kube.KubeBackend/RollbackUpgrade"
+	KubeBackend_ListComponents_FullMethodName       = "/kube.KubeBackend/ListComponents"
+	KubeBackend_Wait_FullMethodName                 = "/kube.KubeBackend/Wait"
 )
 
 // KubeBackendClient is the client API for KubeBackend service.
@@ -41,6 +49,14 @@ type KubeBackendClient interface {
 	ApplyYaml(ctx context.Context, in *ApplyYamlRequest, opts ...grpc.CallOption) (*ApplyYamlResponse, error)
 	DeleteYaml(ctx context.Context, in *ApplyYamlRequest, opts ...grpc.CallOption) (*ApplyYamlResponse, error)
 	UpgradeYaml(ctx context.Context, in *UpgradeYamlRequest, opts ...grpc.CallOption) (*UpgradeYamlResponse, error)
+	GetAuditLog(ctx context.Context, in *GetAuditLogRequest, opts ...grpc.CallOption) (*AuditLog, error)
+	ListClusters(ctx context.Context, in *ListClustersRequest, opts ...grpc.CallOption) (*ClusterList, error)
+	GetInventory(ctx context.Context, in *GetInventoryRequest, opts ...grpc.CallOption) (*Inventory, error)
+	GetUpgradeHistory(ctx context.Context, in *GetUpgradeHistoryRequest, opts ...grpc.CallOption) (*UpgradeHistory, error)
+	GetComponentVersions(ctx context.Context, in *GetComponentVersionsRequest, opts ...grpc.CallOption) (*ComponentVersions, error)
+	RollbackUpgrade(ctx context.Context, in *RollbackUpgradeRequest, opts ...grpc.CallOption) (*RollbackUpgradeResponse, error)
+	ListComponents(ctx context.Context, in *ListComponentsRequest, opts ...grpc.CallOption) (*ComponentList, error)
+	Wait(ctx context.Context, in *WaitRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WaitEvent], error)
 }
 
 type kubeBackendClient struct {
@@ -140,6 +156,95 @@ func (c *kubeBackendClient) UpgradeYaml(ctx context.Context, in *UpgradeYamlRequ
 	return out, nil
 }
 
+func (c *kubeBackendClient) GetAuditLog(ctx context.Context, in *GetAuditLogRequest, opts ...grpc.CallOption) (*AuditLog, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AuditLog)
+	err := c.cc.Invoke(ctx, KubeBackend_GetAuditLog_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) ListClusters(ctx context.Context, in *ListClustersRequest, opts ...grpc.CallOption) (*ClusterList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ClusterList)
+	err := c.cc.Invoke(ctx, KubeBackend_ListClusters_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) GetInventory(ctx context.Context, in *GetInventoryRequest, opts ...grpc.CallOption) (*Inventory, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Inventory)
+	err := c.cc.Invoke(ctx, KubeBackend_GetInventory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) GetUpgradeHistory(ctx context.Context, in *GetUpgradeHistoryRequest, opts ...grpc.CallOption) (*UpgradeHistory, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpgradeHistory)
+	err := c.cc.Invoke(ctx, KubeBackend_GetUpgradeHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) GetComponentVersions(ctx context.Context, in *GetComponentVersionsRequest, opts ...grpc.CallOption) (*ComponentVersions, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ComponentVersions)
+	err := c.cc.Invoke(ctx, KubeBackend_GetComponentVersions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) RollbackUpgrade(ctx context.Context, in *RollbackUpgradeRequest, opts ...grpc.CallOption) (*RollbackUpgradeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RollbackUpgradeResponse)
+	err := c.cc.Invoke(ctx, KubeBackend_RollbackUpgrade_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) ListComponents(ctx context.Context, in *ListComponentsRequest, opts ...grpc.CallOption) (*ComponentList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ComponentList)
+	err := c.cc.Invoke(ctx, KubeBackend_ListComponents_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kubeBackendClient) Wait(ctx context.Context, in *WaitRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WaitEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &KubeBackend_ServiceDesc.Streams[1], KubeBackend_Wait_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WaitRequest, WaitEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KubeBackend_WaitClient = grpc.ServerStreamingClient[WaitEvent]
+
 // KubeBackendServer is the server API for KubeBackend service.
 // All implementations must embed UnimplementedKubeBackendServer
 // for forward compatibility.
@@ -152,6 +257,14 @@ type KubeBackendServer interface {
 	ApplyYaml(context.Context, *ApplyYamlRequest) (*ApplyYamlResponse, error)
 	DeleteYaml(context.Context, *ApplyYamlRequest) (*ApplyYamlResponse, error)
 	UpgradeYaml(context.Context, *UpgradeYamlRequest) (*UpgradeYamlResponse, error)
+	GetAuditLog(context.Context, *GetAuditLogRequest) (*AuditLog, error)
+	ListClusters(context.Context, *ListClustersRequest) (*ClusterList, error)
+	GetInventory(context.Context, *GetInventoryRequest) (*Inventory, error)
+	GetUpgradeHistory(context.Context, *GetUpgradeHistoryRequest) (*UpgradeHistory, error)
+	GetComponentVersions(context.Context, *GetComponentVersionsRequest) (*ComponentVersions, error)
+	RollbackUpgrade(context.Context, *RollbackUpgradeRequest) (*RollbackUpgradeResponse, error)
+	ListComponents(context.Context, *ListComponentsRequest) (*ComponentList, error)
+	Wait(*WaitRequest, grpc.ServerStreamingServer[WaitEvent]) error
 	mustEmbedUnimplementedKubeBackendServer()
 }
 
@@ -186,6 +299,30 @@ func (UnimplementedKubeBackendServer) DeleteYaml(context.Context, *ApplyYamlRequ
 func (UnimplementedKubeBackendServer) UpgradeYaml(context.Context, *UpgradeYamlRequest) (*UpgradeYamlResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpgradeYaml not implemented")
 }
+func (UnimplementedKubeBackendServer) GetAuditLog(context.Context, *GetAuditLogRequest) (*AuditLog, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAuditLog not implemented")
+}
+func (UnimplementedKubeBackendServer) ListClusters(context.Context, *ListClustersRequest) (*ClusterList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListClusters not implemented")
+}
+func (UnimplementedKubeBackendServer) GetInventory(context.Context, *GetInventoryRequest) (*Inventory, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetInventory not implemented")
+}
+func (UnimplementedKubeBackendServer) GetUpgradeHistory(context.Context, *GetUpgradeHistoryRequest) (*UpgradeHistory, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUpgradeHistory not implemented")
+}
+func (UnimplementedKubeBackendServer) GetComponentVersions(context.Context, *GetComponentVersionsRequest) (*ComponentVersions, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetComponentVersions not implemented")
+}
+func (UnimplementedKubeBackendServer) RollbackUpgrade(context.Context, *RollbackUpgradeRequest) (*RollbackUpgradeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RollbackUpgrade not implemented")
+}
+func (UnimplementedKubeBackendServer) ListComponents(context.Context, *ListComponentsRequest) (*ComponentList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListComponents not implemented")
+}
+func (UnimplementedKubeBackendServer) Wait(*WaitRequest, grpc.ServerStreamingServer[WaitEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Wait not implemented")
+}
 func (UnimplementedKubeBackendServer) mustEmbedUnimplementedKubeBackendServer() {}
 func (UnimplementedKubeBackendServer) testEmbeddedByValue()                     {}
 
@@ -344,6 +481,143 @@ func _KubeBackend_UpgradeYaml_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _KubeBackend_GetAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).GetAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_GetAuditLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).GetAuditLog(ctx, req.(*GetAuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_ListClusters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListClustersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).ListClusters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_ListClusters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).ListClusters(ctx, req.(*ListClustersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_GetInventory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetInventoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).GetInventory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_GetInventory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).GetInventory(ctx, req.(*GetInventoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_GetUpgradeHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUpgradeHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).GetUpgradeHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_GetUpgradeHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).GetUpgradeHistory(ctx, req.(*GetUpgradeHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_GetComponentVersions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetComponentVersionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).GetComponentVersions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_GetComponentVersions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).GetComponentVersions(ctx, req.(*GetComponentVersionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_RollbackUpgrade_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackUpgradeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).RollbackUpgrade(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_RollbackUpgrade_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).RollbackUpgrade(ctx, req.(*RollbackUpgradeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_ListComponents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListComponentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KubeBackendServer).ListComponents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KubeBackend_ListComponents_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KubeBackendServer).ListComponents(ctx, req.(*ListComponentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KubeBackend_Wait_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WaitRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KubeBackendServer).Wait(m, &grpc.GenericServerStream[WaitRequest, WaitEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KubeBackend_WaitServer = grpc.ServerStreamingServer[WaitEvent]
+
 // KubeBackend_ServiceDesc is the grpc.ServiceDesc for KubeBackend service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -379,6 +653,34 @@ var KubeBackend_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "UpgradeYaml",
 			Handler:    _KubeBackend_UpgradeYaml_Handler,
 		},
+		{
+			MethodName: "GetAuditLog",
+			Handler:    _KubeBackend_GetAuditLog_Handler,
+		},
+		{
+			MethodName: "ListClusters",
+			Handler:    _KubeBackend_ListClusters_Handler,
+		},
+		{
+			MethodName: "GetInventory",
+			Handler:    _KubeBackend_GetInventory_Handler,
+		},
+		{
+			MethodName: "GetUpgradeHistory",
+			Handler:    _KubeBackend_GetUpgradeHistory_Handler,
+		},
+		{
+			MethodName: "GetComponentVersions",
+			Handler:    _KubeBackend_GetComponentVersions_Handler,
+		},
+		{
+			MethodName: "RollbackUpgrade",
+			Handler:    _KubeBackend_RollbackUpgrade_Handler,
+		},
+		{
+			MethodName: "ListComponents",
+			Handler:    _KubeBackend_ListComponents_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -386,6 +688,11 @@ var KubeBackend_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _KubeBackend_GetPodLogs_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Wait",
+			Handler:       _KubeBackend_Wait_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proto/kube.proto",
 }
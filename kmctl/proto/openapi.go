@@ -0,0 +1,8 @@
+package kube
+
+import _ "embed"
+
+// OpenAPI is the OpenAPI v2 spec of the REST gateway, generated from kube.proto.
+//
+//go:embed kube.swagger.json
+var OpenAPI []byte
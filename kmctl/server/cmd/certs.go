@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"com.kubebackend/m/server/controller"
+)
+
+var (
+	certsDir      string
+	certsCAName   string
+	certsName     string
+	certsHosts    []string
+	certsClient   bool
+	certsForce    bool
+	certsValidity time.Duration
+)
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Generate a local CA and per-robot certificates",
+	Long: `Generate a local CA and per-robot certificates for TLS between kmctl and the server.
+
+	For example:
+	certs ca --dir ./certs
+	certs issue --dir ./certs --name robot1 --host 192.168.5.10 --host robot1.local
+	certs issue --dir ./certs --name kmctl --client`,
+}
+
+var certsCACmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Generate a self-signed CA certificate and key",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := controller.GenerateCA(certsDir, certsCAName, certsValidity); err != nil {
+			log.Fatalf("Failed to generate CA: %v", err)
+		}
+
+		fmt.Printf("CA written to %s\n", filepath.Join(certsDir, "ca.crt"))
+	},
+}
+
+var certsIssueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Issue a server or client certificate signed by the local CA",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !certsClient && len(certsHosts) == 0 {
+			log.Fatalf("Server certificates need at least one --host")
+		}
+
+		if err := controller.IssueCertificate(certsDir, certsName, certsHosts, certsClient, certsForce, certsValidity); err != nil {
+			log.Fatalf("Failed to issue certificate: %v", err)
+		}
+
+		fmt.Printf("Certificate written to %s\n", filepath.Join(certsDir, certsName+".crt"))
+	},
+}
+
+func init() {
+	certsCmd.PersistentFlags().StringVarP(&certsDir, "dir", "d", "certs", "Directory holding the CA and issued certificates")
+	certsCmd.PersistentFlags().DurationVar(&certsValidity, "validity", 5*365*24*time.Hour, "Certificate validity")
+
+	certsCACmd.Flags().StringVar(&certsCAName, "common-name", "kmctl-ca", "Common name of the CA")
+
+	certsIssueCmd.Flags().StringVarP(&certsName, "name", "n", "", "Certificate name, e.g. the robot name")
+	certsIssueCmd.Flags().StringSliceVar(&certsHosts, "host", nil, "Host names or IP addresses the server certificate is valid for")
+	certsIssueCmd.Flags().BoolVar(&certsClient, "client", false, "Issue a client certificate for kmctl instead of a server certificate")
+	certsIssueCmd.Flags().BoolVar(&certsForce, "force", false, "Replace an existing certificate and key of the same name")
+	certsIssueCmd.MarkFlagRequired("name")
+
+	certsCmd.AddCommand(certsCACmd)
+	certsCmd.AddCommand(certsIssueCmd)
+}
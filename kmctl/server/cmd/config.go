@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"com.kubebackend/m/server/controller"
+	"com.kubebackend/m/server/model"
+)
+
+var tableNamePattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the server configuration",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration file, environment variables and referenced files",
+	Long: `Validate the configuration file, environment variables and referenced files.
+
+	For example:
+	config validate --config /etc/kube-backend/config.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		errs := validateConfig(&config)
+		if len(errs) > 0 {
+			fmt.Println("Config is invalid:")
+			for _, err := range errs {
+				fmt.Printf("  %v\n", err)
+			}
+			os.Exit(1)
+		}
+
+		fmt.Println("Config is valid")
+	},
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Print the effective configuration after environment variables are applied",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := yaml.Marshal(&config)
+		if err != nil {
+			fmt.Printf("Failed to marshal config: %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Print(string(out))
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configViewCmd)
+}
+
+func validatePort(name, port string, required bool) error {
+	if port == "" {
+		if required {
+			return fmt.Errorf("%s is required", name)
+		}
+		return nil
+	}
+
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%s %q is not a valid port", name, port)
+	}
+	return nil
+}
+
+func validateFile(name, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+func validateConfig(c *model.Config) []error {
+	var errs []error
+	add := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	add(validatePort("listen.port", c.Listen.Port, true))
+	add(validatePort("listen.healthPort", c.Listen.HealthPort, false))
+	add(validatePort("listen.metricsPort", c.Listen.MetricsPort, false))
+	add(validatePort("listen.httpPort", c.Listen.HTTPPort, false))
+
+	ports := map[string]string{}
+	for _, p := range []struct{ name, port string }{
+		{"listen.port", c.Listen.Port},
+		{"listen.healthPort", c.Listen.HealthPort},
+		{"listen.metricsPort", c.Listen.MetricsPort},
+		{"listen.httpPort", c.Listen.HTTPPort},
+	} {
+		if p.port == "" {
+			continue
+		}
+		if other, ok := ports[p.port]; ok {
+			add(fmt.Errorf("%s and %s use the same port %s", other, p.name, p.port))
+		}
+		ports[p.port] = p.name
+	}
+
+	if c.Fake.Enabled {
+		add(validateFake(&c.Fake))
+	} else {
+		if err := validateFile("kubeconfig", c.Kubeconfig); err != nil {
+			add(err)
+		} else if _, _, err := controller.GetKubeConfig(c.Kubeconfig, c.Context); err != nil {
+			add(err)
+		}
+
+		if len(c.Contexts) > 0 && !slices.Contains(c.Contexts, "*") {
+			contexts, err := controller.GetKubeContexts(c.Kubeconfig)
+			add(err)
+			for _, kubeContext := range c.Contexts {
+				if err == nil && !slices.Contains(contexts, kubeContext) {
+					add(fmt.Errorf("context %q does not exist in the kubeconfig", kubeContext))
+				}
+			}
+		}
+	}
+
+	if c.Database == "" {
+		add(fmt.Errorf("database is required"))
+	}
+
+	if c.HealthInterval <= 0 {
+		add(fmt.Errorf("healthInterval must be positive"))
+	}
+	if c.DrainTimeout < 0 {
+		add(fmt.Errorf("drainTimeout must not be negative"))
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		add(fmt.Errorf("tls.cert and tls.key must be set together"))
+	} else if c.TLS.Cert != "" {
+		_, err := controller.ServerCredentials(c.TLS.Cert, c.TLS.Key, c.TLS.ClientCA)
+		add(err)
+	} else if c.TLS.ClientCA != "" {
+		add(fmt.Errorf("tls.clientCA requires tls.cert and tls.key"))
+	}
+
+	if c.Auth.TokenFile != "" || c.Auth.JWTSecretFile != "" {
+		_, err := controller.NewAuthenticator(c.Auth.TokenFile, c.Auth.JWTSecretFile)
+		add(err)
+	}
+
+	if len(c.Components) == 0 {
+		add(fmt.Errorf("components must not be empty"))
+	}
+	names := map[string]bool{}
+	tables := map[string]bool{}
+	types := map[int32]bool{}
+	for i, component := range c.Components {
+		// clients select components by name ignoring case, or by number
+		name := strings.ToUpper(component.Name)
+		if component.Name == "" {
+			add(fmt.Errorf("components[%d].name is required", i))
+		} else if _, err := strconv.Atoi(component.Name); err == nil {
+			add(fmt.Errorf("components[%d].name %q must not be a number", i, component.Name))
+		} else if names[name] {
+			add(fmt.Errorf("component %s is defined twice", component.Name))
+		}
+		if component.Type < 0 {
+			add(fmt.Errorf("components[%d].type %d must not be negative", i, component.Type))
+		} else if types[component.Type] {
+			add(fmt.Errorf("type %d is used by two components", component.Type))
+		}
+		if !tableNamePattern.MatchString(component.Table) {
+			add(fmt.Errorf("components[%d].table %q must be a lower case SQL identifier", i, component.Table))
+		} else if tables[component.Table] {
+			add(fmt.Errorf("table %s is used by two components", component.Table))
+		}
+		for _, deployment := range component.Deployments {
+			if namespace, object, ok := strings.Cut(deployment, "/"); !ok || namespace == "" || object == "" || strings.Contains(object, "/") {
+				add(fmt.Errorf("component %s: deployment %q must be namespace/name", component.Name, deployment))
+			}
+		}
+		names[name] = true
+		tables[component.Table] = true
+		types[component.Type] = true
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		add(fmt.Errorf("logLevel %q must be debug, info, warn or error", c.LogLevel))
+	}
+
+	return errs
+}
+
+func validateFake(c *model.Fake) error {
+	if c.Tick <= 0 {
+		return fmt.Errorf("fake.tick must be positive")
+	}
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return fmt.Errorf("fake.failureRate must be between 0 and 1")
+	}
+	if c.Robots < 0 {
+		return fmt.Errorf("fake.robots must not be negative")
+	}
+
+	return controller.ValidateFixtures(c)
+}
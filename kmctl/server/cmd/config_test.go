@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"com.kubebackend/m/server/model"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: robot
+  cluster:
+    server: https://127.0.0.1:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: robot-01
+  context: {cluster: robot, user: admin}
+- name: robot-02
+  context: {cluster: robot, user: admin}
+current-context: robot-01
+`
+
+// validTestConfig returns a config that passes validateConfig, with a
+// kubeconfig of the contexts robot-01 and robot-02.
+func validTestConfig(t *testing.T) *model.Config {
+	t.Helper()
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &model.Config{
+		Listen:         model.Listen{Host: "localhost", Port: "50051", HealthPort: "50052"},
+		Kubeconfig:     kubeconfig,
+		Database:       "/database/database.db",
+		HealthInterval: 10 * time.Second,
+		DrainTimeout:   25 * time.Second,
+		Components: []model.Component{
+			{Type: 0, Name: "MICOM_MANAGER", Table: "micom_managers"},
+			{Type: 2, Name: "NAVIGATION", Table: "navigations", Deployments: []string{"robot/navigation"}},
+		},
+		LogLevel: "info",
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *model.Config)
+		want   string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *model.Config) {},
+		},
+		{
+			name:   "duplicate ports",
+			modify: func(c *model.Config) { c.Listen.MetricsPort = "50052" },
+			want:   "listen.healthPort and listen.metricsPort use the same port 50052",
+		},
+		{
+			name:   "port out of range",
+			modify: func(c *model.Config) { c.Listen.HTTPPort = "70000" },
+			want:   `listen.httpPort "70000" is not a valid port`,
+		},
+		{
+			name:   "cert without key",
+			modify: func(c *model.Config) { c.TLS.Cert = "/etc/kube-backend/certs/robot-01.crt" },
+			want:   "tls.cert and tls.key must be set together",
+		},
+		{
+			name:   "client CA without cert",
+			modify: func(c *model.Config) { c.TLS.ClientCA = "/etc/kube-backend/certs/ca.crt" },
+			want:   "tls.clientCA requires tls.cert and tls.key",
+		},
+		{
+			name: "duplicate component name",
+			modify: func(c *model.Config) {
+				c.Components = append(c.Components, model.Component{Type: 3, Name: "navigation", Table: "navigations_2"})
+			},
+			want: "component navigation is defined twice",
+		},
+		{
+			name: "duplicate component type",
+			modify: func(c *model.Config) {
+				c.Components = append(c.Components, model.Component{Type: 2, Name: "MIDDLEWARE", Table: "middlewares"})
+			},
+			want: "type 2 is used by two components",
+		},
+		{
+			name: "duplicate component table",
+			modify: func(c *model.Config) {
+				c.Components = append(c.Components, model.Component{Type: 3, Name: "MIDDLEWARE", Table: "navigations"})
+			},
+			want: "table navigations is used by two components",
+		},
+		{
+			name: "numeric component name",
+			modify: func(c *model.Config) {
+				c.Components = append(c.Components, model.Component{Type: 3, Name: "3", Table: "middlewares"})
+			},
+			want: `components[2].name "3" must not be a number`,
+		},
+		{
+			name:   "deployment without namespace",
+			modify: func(c *model.Config) { c.Components[1].Deployments = []string{"navigation"} },
+			want:   `component NAVIGATION: deployment "navigation" must be namespace/name`,
+		},
+		{
+			name:   "deployment with extra path",
+			modify: func(c *model.Config) { c.Components[1].Deployments = []string{"robot/navigation/0"} },
+			want:   `component NAVIGATION: deployment "robot/navigation/0" must be namespace/name`,
+		},
+		{
+			name:   "missing context",
+			modify: func(c *model.Config) { c.Context = "robot-03" },
+			want:   "robot-03",
+		},
+		{
+			name:   "missing served context",
+			modify: func(c *model.Config) { c.Contexts = []string{"robot-02", "robot-03"} },
+			want:   `context "robot-03" does not exist in the kubeconfig`,
+		},
+		{
+			name:   "invalid log level",
+			modify: func(c *model.Config) { c.LogLevel = "verbose" },
+			want:   `logLevel "verbose" must be debug, info, warn or error`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validTestConfig(t)
+			tt.modify(c)
+
+			errs := validateConfig(c)
+			if tt.want == "" {
+				if len(errs) > 0 {
+					t.Fatalf("validateConfig() = %v, want no errors", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.want) {
+				t.Fatalf("validateConfig() = %v, want one error containing %q", errs, tt.want)
+			}
+		})
+	}
+}
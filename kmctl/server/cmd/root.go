@@ -1,16 +1,33 @@
 package cmd
 
 import (
+	"errors"
+	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"com.kubebackend/m/server/model"
+)
+
+var (
+	cfgFile string
+	config  model.Config
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "kube multi CLI server",
 	Short: "This is a simple CLI server to operate multiple clusters",
 	Long: `This is a simple CLI server to operate multiple clusters.
-	It can be used to serve get nodes, pods, etc. Also, it can be used to apply deployment YAML and delete.`,
+	It can be used to serve get nodes, pods, etc. Also, it can be used to apply deployment YAML and delete.
+
+	The server reads /etc/kube-backend/config.yaml or $HOME/.config/kube-backend/config.yaml
+	when present. Every setting can be overridden by an environment variable named
+	KUBE_BACKEND_<KEY>, e.g. KUBE_BACKEND_DATABASE or KUBE_BACKEND_LISTEN_PORT,
+	and serve flags override both.`,
 }
 
 func Execute() {
@@ -21,5 +38,78 @@ func Execute() {
 }
 
 func init() {
+	cobra.OnInitialize(initConfig)
+
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is /etc/kube-backend/config.yaml)")
+
 	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(certsCmd)
+	rootCmd.AddCommand(tokenCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func setConfigDefaults() {
+	viper.SetDefault("listen.host", "localhost")
+	viper.SetDefault("listen.port", "50051")
+	viper.SetDefault("listen.healthPort", "")
+	viper.SetDefault("listen.metricsPort", "")
+	viper.SetDefault("listen.httpPort", "")
+	viper.SetDefault("kubeconfig", "")
+	viper.SetDefault("context", "")
+	viper.SetDefault("contexts", []string{})
+	viper.SetDefault("database", "/database/database.db")
+	viper.SetDefault("healthInterval", 10*time.Second)
+	viper.SetDefault("drainTimeout", 25*time.Second)
+	viper.SetDefault("tls.cert", "")
+	viper.SetDefault("tls.key", "")
+	viper.SetDefault("tls.clientCA", "")
+	viper.SetDefault("auth.tokenFile", "")
+	viper.SetDefault("auth.jwtSecretFile", "")
+	viper.SetDefault("namespaces", []string{})
+	viper.SetDefault("components", []map[string]interface{}{
+		{"type": 0, "name": "MICOM_MANAGER", "table": "micom_managers", "description": "Micom Manager", "deployments": []string{"robot/micom-manager"}},
+		{"type": 1, "name": "DEVICE_BRINGUP", "table": "device_bringups", "description": "Device Bringup", "deployments": []string{"robot/device-bringup"}},
+		{"type": 2, "name": "NAVIGATION", "table": "navigations", "description": "Navigation", "deployments": []string{"robot/navigation"}},
+		{"type": 3, "name": "MIDDLEWARE", "table": "middlewares", "description": "Middleware", "deployments": []string{"robot/middleware"}},
+	})
+	viper.SetDefault("logLevel", "info")
+	viper.SetDefault("features.reflection", true)
+	viper.SetDefault("features.audit", true)
+	viper.SetDefault("features.informers", true)
+	viper.SetDefault("features.dashboard", true)
+	viper.SetDefault("fake.enabled", false)
+	viper.SetDefault("fake.fixtures", "")
+	viper.SetDefault("fake.robots", 20)
+	viper.SetDefault("fake.tick", 2*time.Second)
+	viper.SetDefault("fake.failureRate", 0.0)
+}
+
+func initConfig() {
+	setConfigDefaults()
+
+	viper.SetEnvPrefix("KUBE_BACKEND")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.SetConfigName("config")
+		viper.SetConfigType("yaml")
+		viper.AddConfigPath("/etc/kube-backend")
+		viper.AddConfigPath("$HOME/.config/kube-backend")
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if cfgFile != "" || !errors.As(err, &notFound) {
+			log.Fatalf("Failed to read config: %v", err)
+		}
+	} else {
+		log.Printf("Using config file %s", viper.ConfigFileUsed())
+	}
+
+	if err := viper.Unmarshal(&config); err != nil {
+		log.Fatalf("Failed to unmarshal config: %v", err)
+	}
 }
@@ -1,51 +1,390 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
 	pb "com.kubebackend/m/proto"
 	"com.kubebackend/m/server/controller"
 )
 
-var (
-	host       string
-	port       string
-	kubeconfig string
-)
-
 var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Serve the gRPC server for the CLI",
 	Long: `Serve the gRPC server for the CLI.
 	You can set the host and port to listen on.
-	Also, you can set the kubeconfig path to connect to the Kubernetes cluster.`,
+	Also, you can set the kubeconfig path and context to connect to the Kubernetes cluster.
+	Without --kubeconfig the server uses $KUBECONFIG (merging every listed file),
+	then the in-cluster config when running in a pod, then $HOME/.kube/config.
+	Set --contexts to serve several contexts of the kubeconfig as separate clusters;
+	requests select one with their cluster field, otherwise --context or the first is used.
+
+	The standard grpc.health.v1 service reports NOT_SERVING while the Kubernetes API
+	server is unreachable, and server reflection is enabled for tools like grpcurl.
+	Set --health-port to also serve the health service in plaintext for kubelet probes.
+
+	Set --tls-cert and --tls-key to serve over TLS, and --tls-client-ca to require
+	client certificates signed by that CA (mutual TLS).
+
+	Set --auth-token-file and/or --auth-jwt-secret-file to require bearer tokens.
+	Each identity has a role (viewer, operator, admin) and may be limited to namespaces.
+
+	Set --metrics-port to serve Prometheus metrics on /metrics over HTTP.
+
+	Set --http-port to also serve every RPC as REST/JSON under /v1/ and the OpenAPI
+	spec on /openapi.json. The gateway calls the gRPC server in process, so
+	authentication, auditing and metrics apply, and it serves HTTPS with the same
+	TLS settings. The audit log records the address of the HTTP client. Log
+	streams are sent as newline delimited JSON, or as server-sent events with
+	"Accept: text/event-stream". Unless features.dashboard is off, the same port
+	serves a web dashboard on /ui/ that signs in with the same bearer tokens.
+
+	Every flag can also be set in the config file or as a KUBE_BACKEND_* environment
+	variable. The config file additionally sets the served namespaces, the upgrade
+	components and which optional features are enabled. The server exits at startup
+	when the config fails the checks of config validate.
+
+	Set --fake to serve simulated clusters instead of real ones: --fake-robots robots
+	named robot-01, robot-02, ... plus one per subdirectory of --fixtures. YAML files in
+	the fixtures directory seed every cluster, files in a subdirectory only that one.
+	The simulator schedules pods, rolls deployments out, reports node conditions and
+	generates logs every --fake-tick.
+
+	On SIGINT or SIGTERM the server stops accepting calls, ends open log streams,
+	waits up to --drain-timeout for in-flight calls and then closes the database.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		log.Println("Starting server...")
 
-		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%s", host, port))
+		if errs := validateConfig(&config); len(errs) > 0 {
+			for _, err := range errs {
+				log.Printf("Invalid config: %v", err)
+			}
+			log.Fatalf("Config is invalid, check it with config validate")
+		}
+		setLogLevel(config.LogLevel)
+
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		host := config.Listen.Host
+
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%s", host, config.Listen.Port))
 		if err != nil {
-			log.Fatalf("Failed to listen: %v", err)
+			fatalf("Failed to listen: %v", err)
+		}
+
+		log.Printf("Listening on %s:%s", host, config.Listen.Port)
+
+		// opts are shared with the in-process server of the HTTP gateway,
+		// tlsOpts only apply to the gRPC port
+		var opts, tlsOpts []grpc.ServerOption
+		if config.TLS.Cert != "" || config.TLS.Key != "" {
+			creds, err := controller.ServerCredentials(config.TLS.Cert, config.TLS.Key, config.TLS.ClientCA)
+			if err != nil {
+				fatalf("Failed to load TLS credentials: %v", err)
+			}
+			tlsOpts = append(tlsOpts, grpc.Creds(creds))
+			log.Printf("TLS enabled (client certificates required: %t)", config.TLS.ClientCA != "")
+		} else if config.TLS.ClientCA != "" {
+			fatalf("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+
+		newServer := controller.NewServer
+		if config.Fake.Enabled {
+			newServer = controller.NewFakeServer
+		}
+
+		s, err := newServer(&config)
+		if err != nil {
+			fatalf("Failed to create kube controller: %v", err)
+		}
+		log.Printf("Serving clusters %v (default %s)", s.ClusterNames(), s.DefaultCluster())
+		s.WaitReady(ctx)
+
+		for _, kubeCon := range s.Clusters() {
+			if simulator, ok := kubeCon.(*controller.Simulator); ok {
+				go simulator.Run(ctx)
+			}
+		}
+		if config.Fake.Enabled {
+			log.Printf("Simulating %d clusters every %s", len(s.ClusterNames()), config.Fake.Tick)
+		}
+
+		// the auditor runs first to also record calls rejected by authentication
+		if db := s.DB(); db != nil && config.Features.Audit {
+			auditor := controller.NewAuditor(db, s.DefaultCluster())
+			opts = append(opts, grpc.ChainUnaryInterceptor(auditor.UnaryInterceptor()))
+		}
+
+		var registry *prometheus.Registry
+		if config.Listen.MetricsPort != "" {
+			registry = controller.NewMetricsRegistry()
+			opts = append(opts,
+				grpc.ChainUnaryInterceptor(controller.GRPCMetrics.UnaryServerInterceptor(), s.OperationsInterceptor()),
+				grpc.ChainStreamInterceptor(controller.GRPCMetrics.StreamServerInterceptor()),
+			)
+		}
+
+		var auth *controller.Authenticator
+		if config.Auth.TokenFile != "" || config.Auth.JWTSecretFile != "" {
+			auth, err = controller.NewAuthenticator(config.Auth.TokenFile, config.Auth.JWTSecretFile)
+			if err != nil {
+				fatalf("Failed to load authentication config: %v", err)
+			}
+			opts = append(opts,
+				grpc.ChainUnaryInterceptor(auth.UnaryInterceptor()),
+				grpc.ChainStreamInterceptor(auth.StreamInterceptor()),
+			)
+			log.Println("Token authentication enabled")
+		} else {
+			log.Println("Token authentication disabled, every caller is allowed all operations")
 		}
 
-		log.Printf("Listening on %s:%s", host, port)
+		if len(config.Namespaces) > 0 {
+			log.Printf("Serving namespaces %v", config.Namespaces)
+		}
 
-		s := controller.NewServer(kubeconfig)
-		grpcServer := grpc.NewServer()
+		grpcServer := grpc.NewServer(append(tlsOpts, opts...)...)
 		pb.RegisterKubeBackendServer(grpcServer, s)
 
-		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("Failed to serve: %v", err)
+		healthServer := health.NewServer()
+		healthpb.RegisterHealthServer(grpcServer, healthServer)
+		go controller.WatchHealth(ctx, s, healthServer, config.HealthInterval)
+
+		var healthGrpcServer *grpc.Server
+		if healthPort := config.Listen.HealthPort; healthPort != "" {
+			healthLis, err := net.Listen("tcp", fmt.Sprintf("%s:%s", host, healthPort))
+			if err != nil {
+				fatalf("Failed to listen for health checks: %v", err)
+			}
+
+			healthGrpcServer = grpc.NewServer()
+			healthpb.RegisterHealthServer(healthGrpcServer, healthServer)
+			go func() {
+				if err := healthGrpcServer.Serve(healthLis); err != nil {
+					slog.Error("Failed to serve health checks", "err", err)
+				}
+			}()
+			log.Printf("Health checks on %s:%s", host, healthPort)
+		}
+
+		if config.Features.Reflection {
+			reflection.Register(grpcServer)
+		}
+
+		var metricsServer *http.Server
+		if registry != nil {
+			controller.GRPCMetrics.InitializeMetrics(grpcServer)
+			if config.Features.Informers {
+				for _, kubeCon := range s.Clusters() {
+					go kubeCon.WatchInformers(ctx, 10*time.Minute)
+				}
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+			metricsServer = &http.Server{
+				Addr:              fmt.Sprintf("%s:%s", host, config.Listen.MetricsPort),
+				Handler:           mux,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					fatalf("Failed to serve metrics: %v", err)
+				}
+			}()
+			log.Printf("Metrics on http://%s:%s/metrics", host, config.Listen.MetricsPort)
+		}
+
+		var httpServer *http.Server
+		var gatewayServer *grpc.Server
+		if config.Listen.HTTPPort != "" {
+			var conn *grpc.ClientConn
+			gatewayServer, conn, err = controller.ServeGateway(s, opts...)
+			if err != nil {
+				fatalf("Failed to connect the HTTP gateway: %v", err)
+			}
+			defer conn.Close()
+
+			gateway, err := controller.NewGateway(ctx, conn)
+			if err != nil {
+				fatalf("Failed to create the HTTP gateway: %v", err)
+			}
+
+			mux := http.NewServeMux()
+			mux.Handle("/", gateway)
+			if config.Features.Dashboard {
+				mux.Handle("/ui/", controller.NewDashboard(config.Namespaces, auth))
+				mux.Handle("/{$}", http.RedirectHandler("/ui/", http.StatusFound))
+			}
+
+			httpServer = &http.Server{
+				Addr:              fmt.Sprintf("%s:%s", host, config.Listen.HTTPPort),
+				Handler:           mux,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			scheme := "http"
+			if config.TLS.Cert != "" {
+				httpServer.TLSConfig, err = controller.ServerTLSConfig(config.TLS.Cert, config.TLS.Key, config.TLS.ClientCA)
+				if err != nil {
+					fatalf("Failed to load TLS credentials: %v", err)
+				}
+				scheme = "https"
+			}
+			go func() {
+				var err error
+				if httpServer.TLSConfig != nil {
+					err = httpServer.ListenAndServeTLS("", "")
+				} else {
+					err = httpServer.ListenAndServe()
+				}
+				if err != nil && err != http.ErrServerClosed {
+					fatalf("Failed to serve HTTP gateway: %v", err)
+				}
+			}()
+			log.Printf("HTTP gateway on %s://%s:%s/v1/", scheme, host, config.Listen.HTTPPort)
+			if config.Features.Dashboard {
+				log.Printf("Dashboard on %s://%s:%s/ui/", scheme, host, config.Listen.HTTPPort)
+			}
+		}
+
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- grpcServer.Serve(lis)
+		}()
+
+		select {
+		case err := <-serveErr:
+			slog.Error("Failed to serve", "err", err)
+		case <-ctx.Done():
+			log.Println("Shutting down...")
 		}
+
+		healthServer.Shutdown()
+		s.CloseStreams()
+		if httpServer != nil {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), config.DrainTimeout)
+			httpServer.Shutdown(shutdownCtx)
+			cancel()
+			gatewayServer.Stop()
+		}
+		drain(grpcServer, config.DrainTimeout)
+
+		if healthGrpcServer != nil {
+			healthGrpcServer.Stop()
+		}
+
+		if metricsServer != nil {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			metricsServer.Shutdown(shutdownCtx)
+			cancel()
+		}
+
+		s.Close()
+		log.Println("Server stopped")
 	},
 }
 
+// setLogLevel sends the log package and slog to a handler that drops records
+// below level. Plain log calls are logged at info.
+func setLogLevel(level string) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		l = slog.LevelInfo
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: l})))
+}
+
+// fatalf logs at error level and exits, so the message is not dropped like a
+// log.Fatalf at info would be when logLevel is warn or error.
+func fatalf(format string, args ...interface{}) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// drain waits for in-flight calls to finish and forces the remaining ones
+// closed after timeout.
+func drain(grpcServer *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		slog.Warn("In-flight calls did not finish in time, closing them", "timeout", timeout)
+		grpcServer.Stop()
+	}
+}
+
 func init() {
-	serveCmd.Flags().StringVarP(&host, "host", "H", "localhost", "Host to listen on")
-	serveCmd.Flags().StringVarP(&port, "port", "P", "50051", "Port to listen on")
-	serveCmd.Flags().StringVarP(&kubeconfig, "kubeconfig", "K", "", "Path to kubeconfig")
+	serveCmd.Flags().StringP("host", "H", "localhost", "Host to listen on")
+	serveCmd.Flags().StringP("port", "P", "50051", "Port to listen on")
+	serveCmd.Flags().StringP("kubeconfig", "K", "", "Path to kubeconfig (default $KUBECONFIG, the in-cluster config, then $HOME/.kube/config)")
+	serveCmd.Flags().String("context", "", "Kubeconfig context to use instead of the current context")
+	serveCmd.Flags().StringSlice("contexts", nil, "Kubeconfig contexts to serve as separate clusters, \"*\" for all")
+	serveCmd.Flags().String("database", "/database/database.db", "Path to the SQLite database for upgrade records and the audit log")
+	serveCmd.Flags().Duration("health-interval", 10*time.Second, "Interval between Kubernetes API health checks")
+	serveCmd.Flags().String("health-port", "", "Optional plaintext port serving only the health service")
+	serveCmd.Flags().String("metrics-port", "", "Optional HTTP port serving Prometheus metrics on /metrics")
+	serveCmd.Flags().String("http-port", "", "Optional port serving the REST/JSON gateway and its OpenAPI spec")
+	serveCmd.Flags().Duration("drain-timeout", 25*time.Second, "Time to wait for in-flight calls on shutdown")
+	serveCmd.Flags().String("tls-cert", "", "Path to the server TLS certificate")
+	serveCmd.Flags().String("tls-key", "", "Path to the server TLS key")
+	serveCmd.Flags().String("tls-client-ca", "", "Path to the CA that signs client certificates (enables mutual TLS)")
+	serveCmd.Flags().String("auth-token-file", "", "Path to a YAML file with static bearer tokens and their roles")
+	serveCmd.Flags().String("auth-jwt-secret-file", "", "Path to the HMAC secret used to verify JWT bearer tokens")
+	serveCmd.Flags().String("log-level", "info", "Lowest level logged: debug, info, warn or error")
+	serveCmd.Flags().Bool("fake", false, "Serve simulated in-memory clusters instead of the kubeconfig")
+	serveCmd.Flags().String("fixtures", "", "Directory of YAML fixtures seeding the simulated clusters")
+	serveCmd.Flags().Int("fake-robots", 20, "Number of simulated robots besides the fixture subdirectories")
+	serveCmd.Flags().Duration("fake-tick", 2*time.Second, "Interval between simulation steps")
+	serveCmd.Flags().Float64("fake-failure-rate", 0, "Chance per step that a node turns NotReady or a container crashes")
+
+	// flags override the config file and environment variables
+	for flag, key := range map[string]string{
+		"host":                 "listen.host",
+		"port":                 "listen.port",
+		"kubeconfig":           "kubeconfig",
+		"context":              "context",
+		"contexts":             "contexts",
+		"database":             "database",
+		"health-interval":      "healthInterval",
+		"health-port":          "listen.healthPort",
+		"metrics-port":         "listen.metricsPort",
+		"http-port":            "listen.httpPort",
+		"drain-timeout":        "drainTimeout",
+		"tls-cert":             "tls.cert",
+		"tls-key":              "tls.key",
+		"tls-client-ca":        "tls.clientCA",
+		"auth-token-file":      "auth.tokenFile",
+		"auth-jwt-secret-file": "auth.jwtSecretFile",
+		"log-level":            "logLevel",
+		"fake":                 "fake.enabled",
+		"fixtures":             "fake.fixtures",
+		"fake-robots":          "fake.robots",
+		"fake-tick":            "fake.tick",
+		"fake-failure-rate":    "fake.failureRate",
+	} {
+		viper.BindPFlag(key, serveCmd.Flags().Lookup(flag))
+	}
 }
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/controller"
+	"com.kubebackend/m/server/model"
+)
+
+// shutdownServer serves a fake backend on bufconn. GetNodes calls block in
+// an interceptor until release is closed, so they stay in flight during
+// shutdown; entered receives a value once such a call has started.
+type shutdownServer struct {
+	grpcServer   *grpc.Server
+	client       pb.KubeBackendClient
+	closeStreams func()
+	entered      chan struct{}
+	release      chan struct{}
+}
+
+func newShutdownServer(t *testing.T) *shutdownServer {
+	t.Helper()
+
+	s, err := controller.NewServerWithBackends(
+		&model.Config{Database: filepath.Join(t.TempDir(), "test.db")},
+		[]controller.Backend{controller.NewFakeKubeController("sim-01")},
+	)
+	if err != nil {
+		t.Fatalf("NewServerWithBackends: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	ss := &shutdownServer{
+		closeStreams: s.CloseStreams,
+		entered:      make(chan struct{}, 1),
+		release:      make(chan struct{}),
+	}
+	slow := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if info.FullMethod == pb.KubeBackend_GetNodes_FullMethodName {
+			ss.entered <- struct{}{}
+			select {
+			case <-ss.release:
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+		}
+		return handler(ctx, req)
+	}
+
+	lis := bufconn.Listen(1024 * 1024)
+	ss.grpcServer = grpc.NewServer(grpc.UnaryInterceptor(slow))
+	pb.RegisterKubeBackendServer(ss.grpcServer, s)
+	go ss.grpcServer.Serve(lis)
+	t.Cleanup(ss.grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///kmctl",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	ss.client = pb.NewKubeBackendClient(conn)
+
+	return ss
+}
+
+// startSlowCall starts a GetNodes call and returns its result once it ends.
+func (ss *shutdownServer) startSlowCall(t *testing.T) <-chan error {
+	t.Helper()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := ss.client.GetNodes(context.Background(), &pb.GetNodesRequest{Cluster: "sim-01"})
+		done <- err
+	}()
+
+	select {
+	case <-ss.entered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetNodes did not start")
+	}
+	return done
+}
+
+func TestShutdown(t *testing.T) {
+	ss := newShutdownServer(t)
+
+	// The pod never exists, so the stream stays open until shutdown.
+	stream, err := ss.client.Wait(context.Background(), &pb.WaitRequest{
+		Cluster:   "sim-01",
+		Kind:      "Pod",
+		Name:      "missing",
+		Namespace: "robot",
+		Condition: "condition=Ready",
+	})
+	if err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	unary := ss.startSlowCall(t)
+
+	ss.closeStreams()
+	_, err = stream.Recv()
+	if st := status.Convert(err); st.Code() != codes.Unavailable || st.Message() != "server shutting down" {
+		t.Errorf("stream ended with %v, want Unavailable server shutting down", err)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		drain(ss.grpcServer, 5*time.Second)
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		t.Fatal("drain returned while GetNodes was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(ss.release)
+	if err := <-unary; err != nil {
+		t.Errorf("in-flight GetNodes failed: %v", err)
+	}
+	select {
+	case <-drained:
+	case <-time.After(2 * time.Second):
+		t.Fatal("drain did not return after the in-flight call finished")
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	ss := newShutdownServer(t)
+	unary := ss.startSlowCall(t)
+
+	ss.closeStreams()
+	start := time.Now()
+	drain(ss.grpcServer, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("drain took %s, want it to stop after the timeout", elapsed)
+	}
+
+	select {
+	case err := <-unary:
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("stuck GetNodes ended with %v, want Unavailable", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stuck GetNodes was not closed by the drain timeout")
+	}
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"com.kubebackend/m/client/controller"
+	pb "com.kubebackend/m/proto"
+)
+
+// mutatingMethods are the RPCs recorded in the audit log. Every new RPC that
+// changes the cluster or the database must be added here.
+var mutatingMethods = map[string]bool{
+	pb.KubeBackend_ApplyYaml_FullMethodName:       true,
+	pb.KubeBackend_DeleteYaml_FullMethodName:      true,
+	pb.KubeBackend_UpgradeYaml_FullMethodName:     true,
+	pb.KubeBackend_RollbackUpgrade_FullMethodName: true,
+}
+
+// yamlRequest is implemented by every request that carries a manifest.
+type yamlRequest interface {
+	GetYaml() string
+}
+
+// clusterRequest is implemented by every request that names a cluster.
+type clusterRequest interface {
+	GetCluster() string
+}
+
+// dryRunRequest is implemented by every request that can be a dry run.
+type dryRunRequest interface {
+	GetDryRun() bool
+}
+
+// prunedResponse is implemented by every response that reports the objects
+// deleted because they were removed from an apply set.
+type prunedResponse interface {
+	GetPruned() []string
+}
+
+// objectsResponse is implemented by every response that reports the objects
+// it changed without a manifest in the request, like a rollback.
+type objectsResponse interface {
+	GetObjects() []string
+}
+
+type auditCallKey struct{}
+
+// auditCall carries the caller from the authenticator back out to the
+// auditor, which runs outside of it to also see rejected calls.
+type auditCall struct {
+	caller string
+}
+
+// noteCaller records the authenticated caller of an audited call.
+func noteCaller(ctx context.Context, identity *Identity) {
+	if call, ok := ctx.Value(auditCallKey{}).(*auditCall); ok {
+		call.caller = identity.Name
+	}
+}
+
+// Auditor writes a record of every mutating RPC to the audit table.
+type Auditor struct {
+	db             *controller.DBController
+	defaultCluster string
+}
+
+// NewAuditor records requests without a cluster under defaultCluster.
+func NewAuditor(db *controller.DBController, defaultCluster string) *Auditor {
+	return &Auditor{
+		db:             db,
+		defaultCluster: defaultCluster,
+	}
+}
+
+func (a *Auditor) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !mutatingMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		call := &auditCall{}
+		ctx = context.WithValue(ctx, auditCallKey{}, call)
+		resp, err := handler(ctx, req)
+		a.record(ctx, call, info.FullMethod, req, resp, start, err)
+
+		return resp, err
+	}
+}
+
+func (a *Auditor) record(ctx context.Context, call *auditCall, method string, req, resp interface{}, start time.Time, err error) {
+	audit := controller.Audit{
+		Caller:      "anonymous",
+		Cluster:     a.defaultCluster,
+		Method:      path.Base(method),
+		Result:      status.Code(err).String(),
+		Duration_ms: time.Since(start).Milliseconds(),
+		Created_at:  start.UTC(),
+	}
+
+	if r, ok := req.(clusterRequest); ok && r.GetCluster() != "" {
+		audit.Cluster = r.GetCluster()
+	}
+
+	if call.caller != "" {
+		audit.Caller = call.caller
+	}
+
+	if addr, ok := ctx.Value(remoteAddrKey{}).(string); ok {
+		// the HTTP client of a call through the gateway
+		audit.Peer_addr = addr
+	} else if p, ok := peer.FromContext(ctx); ok {
+		audit.Peer_addr = p.Addr.String()
+	}
+
+	if err != nil {
+		audit.Error = err.Error()
+	}
+
+	if m, ok := req.(proto.Message); ok {
+		data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+		sum := sha256.Sum256(data)
+		audit.Request_hash = hex.EncodeToString(sum[:])
+	}
+
+	var objects []string
+	if r, ok := req.(yamlRequest); ok {
+		objects, _ = getYamlObjects(r.GetYaml())
+	}
+	if r, ok := resp.(objectsResponse); ok {
+		objects = append(objects, r.GetObjects()...)
+	}
+	if r, ok := resp.(prunedResponse); ok {
+		if dryRun, ok := req.(dryRunRequest); !ok || !dryRun.GetDryRun() {
+			objects = append(objects, r.GetPruned()...)
+		}
+	}
+	audit.Objects = strings.Join(objects, ",")
+
+	if err := a.db.InsertAudit(&audit); err != nil {
+		slog.Error("Failed to write audit record", "method", audit.Method, "err", err)
+	}
+}
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"com.kubebackend/m/client/controller"
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
+)
+
+func TestAuditorRecordsRejectedCalls(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "audit.db")
+	db := controller.NewDB(&dbPath)
+	auth, _ := newTestAuthenticator(t)
+	auditor := NewAuditor(db, "sim-01")
+
+	// the same order as serve: the auditor outside the authenticator
+	chain := func(ctx context.Context, req interface{}, resp interface{}) error {
+		info := &grpc.UnaryServerInfo{FullMethod: pb.KubeBackend_ApplyYaml_FullMethodName}
+		_, err := auditor.UnaryInterceptor()(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return auth.UnaryInterceptor()(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return resp, nil
+			})
+		})
+		return err
+	}
+	withToken := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	request := &pb.ApplyYamlRequest{Yaml: testNavigationService}
+	if err := chain(withToken("wrong-token"), request, nil); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("wrong token: %v", err)
+	}
+	if err := chain(withToken("viewer-token"), request, nil); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("viewer: %v", err)
+	}
+	response := &pb.ApplyYamlResponse{Pruned: []string{"Deployment/robot/old-navigation"}}
+	if err := chain(withToken("operator-token"), request, response); err != nil {
+		t.Fatalf("operator: %v", err)
+	}
+
+	var audits []controller.Audit
+	if err := db.GetAudits(&controller.AuditFilter{}, &audits); err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 3 {
+		t.Fatalf("got %d audit records, want 3", len(audits))
+	}
+	results := map[string]controller.Audit{}
+	for _, audit := range audits {
+		results[audit.Result] = audit
+	}
+	if audit := results[codes.Unauthenticated.String()]; audit.Caller != "anonymous" {
+		t.Errorf("unauthenticated caller = %q", audit.Caller)
+	}
+	if audit := results[codes.PermissionDenied.String()]; audit.Caller != "alice" {
+		t.Errorf("denied caller = %q, want alice", audit.Caller)
+	}
+	if audit := results[codes.OK.String()]; audit.Caller != "bob" || audit.Objects != "Service/robot/navigation,Deployment/robot/old-navigation" {
+		t.Errorf("applied by %q with objects %q", audit.Caller, audit.Objects)
+	}
+}
+
+func TestAuditorRecordsRollbackObjects(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "audit.db")
+	db := controller.NewDB(&dbPath)
+	auditor := NewAuditor(db, "sim-01")
+
+	info := &grpc.UnaryServerInfo{FullMethod: pb.KubeBackend_RollbackUpgrade_FullMethodName}
+	response := &pb.RollbackUpgradeResponse{Objects: []string{"Service/robot/navigation"}}
+	_, err := auditor.UnaryInterceptor()(context.Background(), &pb.RollbackUpgradeRequest{}, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return response, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var audits []controller.Audit
+	if err := db.GetAudits(&controller.AuditFilter{}, &audits); err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 1 || audits[0].Objects != "Service/robot/navigation" {
+		t.Errorf("audits = %+v", audits)
+	}
+}
+
+func TestGetAuditLogNamespaces(t *testing.T) {
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{NewFakeKubeController("sim-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	now := time.Now()
+	for i, audit := range []controller.Audit{
+		{Caller: "release-bot", Objects: "Deployment/robot/navigation"},
+		{Caller: "release-bot", Objects: "Service/default/gateway"},
+		{Caller: "release-bot", Objects: "Deployment/robot/navigation,Service/default/gateway"},
+		{Caller: "release-bot"},
+		{Caller: "bob"},
+	} {
+		audit.Cluster = "sim-01"
+		audit.Created_at = now.Add(-time.Duration(i) * time.Minute)
+		if err := s.db.InsertAudit(&audit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := func(ctx context.Context, limit int32) []string {
+		t.Helper()
+		auditLog, err := s.GetAuditLog(ctx, &pb.GetAuditLogRequest{Limit: limit})
+		if err != nil {
+			t.Fatalf("GetAuditLog: %v", err)
+		}
+		var got []string
+		for _, entry := range auditLog.Entries {
+			got = append(got, entry.Caller+" "+strings.Join(entry.Objects, ","))
+		}
+		return got
+	}
+
+	admin := context.WithValue(context.Background(), identityKey{}, &Identity{Name: "alice", Role: RoleAdmin})
+	if got := entries(admin, 0); len(got) != 5 {
+		t.Errorf("admin entries = %q, want all 5", got)
+	}
+
+	bob := context.WithValue(context.Background(), identityKey{}, &Identity{Name: "bob", Role: RoleOperator, Namespaces: []string{"robot"}})
+	want := []string{"release-bot Deployment/robot/navigation", "bob "}
+	if got := entries(bob, 0); !slices.Equal(got, want) {
+		t.Errorf("entries of a robot operator = %q, want %q", got, want)
+	}
+	if got := entries(bob, 1); !slices.Equal(got, want[:1]) {
+		t.Errorf("limited entries of a robot operator = %q, want %q", got, want[:1])
+	}
+}
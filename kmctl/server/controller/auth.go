@@ -0,0 +1,343 @@
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
+)
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roleLevels = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// methodRoles is the minimum role needed for each RPC. KubeBackend methods
+// missing from this map need the admin role.
+var methodRoles = map[string]Role{
+	pb.KubeBackend_GetNodes_FullMethodName:             RoleViewer,
+	pb.KubeBackend_GetNode_FullMethodName:              RoleViewer,
+	pb.KubeBackend_GetPods_FullMethodName:              RoleViewer,
+	pb.KubeBackend_GetPod_FullMethodName:               RoleViewer,
+	pb.KubeBackend_GetPodLogs_FullMethodName:           RoleViewer,
+	pb.KubeBackend_ApplyYaml_FullMethodName:            RoleOperator,
+	pb.KubeBackend_DeleteYaml_FullMethodName:           RoleOperator,
+	pb.KubeBackend_UpgradeYaml_FullMethodName:          RoleOperator,
+	pb.KubeBackend_RollbackUpgrade_FullMethodName:      RoleOperator,
+	pb.KubeBackend_ListComponents_FullMethodName:       RoleViewer,
+	pb.KubeBackend_GetAuditLog_FullMethodName:          RoleOperator,
+	pb.KubeBackend_ListClusters_FullMethodName:         RoleViewer,
+	pb.KubeBackend_GetInventory_FullMethodName:         RoleViewer,
+	pb.KubeBackend_GetUpgradeHistory_FullMethodName:    RoleViewer,
+	pb.KubeBackend_GetComponentVersions_FullMethodName: RoleViewer,
+	pb.KubeBackend_Wait_FullMethodName:                 RoleViewer,
+}
+
+// publicServices are served without a token so that probes keep working.
+var publicServices = []string{
+	"/" + healthpb.Health_ServiceDesc.ServiceName + "/",
+}
+
+func ParseRole(role string) (Role, error) {
+	r := Role(strings.ToLower(role))
+	if _, ok := roleLevels[r]; !ok {
+		return "", fmt.Errorf("unknown role %q (viewer, operator, admin)", role)
+	}
+	return r, nil
+}
+
+// Identity is the authenticated caller of an RPC.
+type Identity struct {
+	Name       string   `yaml:"name"`
+	Role       Role     `yaml:"role"`
+	Namespaces []string `yaml:"namespaces"`
+}
+
+func (i *Identity) HasRole(role Role) bool {
+	return roleLevels[i.Role] >= roleLevels[role]
+}
+
+// AllowsNamespace reports whether the identity may touch namespace. An empty
+// namespace list or "*" allows every namespace, including "" (all of them).
+func (i *Identity) AllowsNamespace(namespace string) bool {
+	return model.NamespaceAllowed(i.Namespaces, namespace)
+}
+
+type identityKey struct{}
+
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok
+}
+
+// CheckNamespace fails with PermissionDenied when the caller in ctx may not
+// use namespace. It allows everything when authentication is disabled.
+func CheckNamespace(ctx context.Context, namespace string) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if !identity.AllowsNamespace(namespace) {
+		return status.Errorf(codes.PermissionDenied, "%s may not use namespace %q", identity.Name, namespace)
+	}
+	return nil
+}
+
+type tokenFile struct {
+	Tokens []struct {
+		Identity `yaml:",inline"`
+		Token    string `yaml:"token"`
+	} `yaml:"tokens"`
+}
+
+type jwtClaims struct {
+	Role       string   `json:"role"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Authenticator validates bearer tokens against a static token file and/or
+// HMAC-signed JWTs, then enforces the role needed by each RPC.
+type Authenticator struct {
+	tokens    []staticToken
+	jwtSecret []byte
+}
+
+type staticToken struct {
+	token    []byte
+	identity *Identity
+}
+
+func NewAuthenticator(tokenPath, jwtSecretPath string) (*Authenticator, error) {
+	a := &Authenticator{}
+
+	if tokenPath != "" {
+		data, err := os.ReadFile(tokenPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+
+		var file tokenFile
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse token file: %w", err)
+		}
+
+		for _, t := range file.Tokens {
+			if t.Token == "" || t.Name == "" {
+				return nil, fmt.Errorf("token file entries need a name and a token")
+			}
+			role, err := ParseRole(string(t.Role))
+			if err != nil {
+				return nil, fmt.Errorf("token %s: %w", t.Name, err)
+			}
+			identity := t.Identity
+			identity.Role = role
+			a.tokens = append(a.tokens, staticToken{token: []byte(t.Token), identity: &identity})
+		}
+	}
+
+	if jwtSecretPath != "" {
+		secret, err := os.ReadFile(jwtSecretPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwt secret: %w", err)
+		}
+		a.jwtSecret = []byte(strings.TrimSpace(string(secret)))
+		if len(a.jwtSecret) == 0 {
+			return nil, fmt.Errorf("jwt secret %s is empty", jwtSecretPath)
+		}
+	}
+
+	return a, nil
+}
+
+// IssueJWT signs a token for identity with the HMAC secret. A zero ttl
+// creates a token that never expires.
+func IssueJWT(secret []byte, identity *Identity, ttl time.Duration) (string, error) {
+	claims := jwtClaims{
+		Role:       string(identity.Role),
+		Namespaces: identity.Namespaces,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:  identity.Name,
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if ttl > 0 {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(ttl))
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+func (a *Authenticator) authenticate(ctx context.Context) (*Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization must be a bearer token")
+	}
+
+	if identity := a.staticIdentity(token); identity != nil {
+		return identity, nil
+	}
+
+	if a.jwtSecret != nil {
+		claims := &jwtClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+			return a.jwtSecret, nil
+		}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+		if err == nil {
+			role, err := ParseRole(claims.Role)
+			if err != nil {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+			return &Identity{
+				Name:       claims.Subject,
+				Role:       role,
+				Namespaces: claims.Namespaces,
+			}, nil
+		}
+		slog.Warn("Rejected jwt", "err", err)
+	}
+
+	return nil, status.Error(codes.Unauthenticated, "invalid token")
+}
+
+// staticIdentity returns the identity of a token from the token file. Every
+// token is compared in constant time so the lookup leaks no prefix matches.
+func (a *Authenticator) staticIdentity(token string) *Identity {
+	var identity *Identity
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 {
+			identity = t.identity
+		}
+	}
+
+	return identity
+}
+
+// AuthenticateHTTP authenticates the bearer token of an HTTP request the same
+// way as gRPC metadata.
+func (a *Authenticator) AuthenticateHTTP(r *http.Request) (*Identity, error) {
+	ctx := metadata.NewIncomingContext(r.Context(), metadata.Pairs("authorization", r.Header.Get("Authorization")))
+	return a.authenticate(ctx)
+}
+
+func (a *Authenticator) authorize(ctx context.Context, method string) (context.Context, error) {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return ctx, nil
+		}
+	}
+
+	identity, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	noteCaller(ctx, identity)
+
+	required, ok := methodRoles[method]
+	if !ok {
+		required = RoleAdmin
+		if !strings.HasPrefix(method, "/"+pb.KubeBackend_ServiceDesc.ServiceName+"/") {
+			// reflection and other infrastructure services
+			required = RoleViewer
+		}
+	}
+
+	if !identity.HasRole(required) {
+		slog.Warn("Denied", "method", method, "caller", identity.Name, "role", identity.Role)
+		return nil, status.Errorf(codes.PermissionDenied, "%s needs the %s role", method, required)
+	}
+
+	return context.WithValue(ctx, identityKey{}, identity), nil
+}
+
+// namespaced is implemented by every request that carries a namespace field.
+type namespaced interface {
+	GetNamespace() string
+}
+
+// filteredMethods leave out what the caller may not see, so they are allowed
+// with an empty namespace, meaning all of them, for every caller.
+var filteredMethods = map[string]bool{
+	pb.KubeBackend_GetInventory_FullMethodName: true,
+}
+
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		if r, ok := req.(namespaced); ok && !(filteredMethods[info.FullMethod] && r.GetNamespace() == "") {
+			if err := CheckNamespace(ctx, r.GetNamespace()); err != nil {
+				return nil, err
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authStream carries the identity in its context and checks the namespace
+// of every message received from the client.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	if r, ok := m.(namespaced); ok {
+		return CheckNamespace(s.ctx, r.GetNamespace())
+	}
+
+	return nil
+}
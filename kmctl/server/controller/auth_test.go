@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "com.kubebackend/m/proto"
+)
+
+const testTokens = `tokens:
+  - name: alice
+    token: viewer-token
+    role: viewer
+  - name: bob
+    token: operator-token
+    role: operator
+    namespaces: [robot]
+`
+
+func newTestAuthenticator(t *testing.T) (*Authenticator, []byte) {
+	t.Helper()
+
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "tokens.yaml")
+	secretPath := filepath.Join(dir, "jwt.secret")
+	if err := os.WriteFile(tokenPath, []byte(testTokens), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secretPath, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := NewAuthenticator(tokenPath, secretPath)
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	return auth, []byte("secret")
+}
+
+func bearerContext(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestAuthorize(t *testing.T) {
+	auth, secret := newTestAuthenticator(t)
+
+	jwtToken, err := IssueJWT(secret, &Identity{Name: "ci", Role: RoleAdmin}, time.Hour)
+	if err != nil {
+		t.Fatalf("IssueJWT: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"missing token", context.Background(), pb.KubeBackend_GetNodes_FullMethodName, codes.Unauthenticated},
+		{"unknown token", bearerContext("nope"), pb.KubeBackend_GetNodes_FullMethodName, codes.Unauthenticated},
+		{"viewer reads", bearerContext("viewer-token"), pb.KubeBackend_GetNodes_FullMethodName, codes.OK},
+		{"viewer applies", bearerContext("viewer-token"), pb.KubeBackend_ApplyYaml_FullMethodName, codes.PermissionDenied},
+		{"operator applies", bearerContext("operator-token"), pb.KubeBackend_ApplyYaml_FullMethodName, codes.OK},
+		{"unknown method needs admin", bearerContext("operator-token"), "/kube.KubeBackend/Unknown", codes.PermissionDenied},
+		{"jwt admin", bearerContext(jwtToken), "/kube.KubeBackend/Unknown", codes.OK},
+		{"health is public", context.Background(), "/grpc.health.v1.Health/Check", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := auth.authorize(tt.ctx, tt.method)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("authorize = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNamespace(t *testing.T) {
+	auth, _ := newTestAuthenticator(t)
+
+	ctx, err := auth.authorize(bearerContext("operator-token"), pb.KubeBackend_GetPods_FullMethodName)
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	if err := CheckNamespace(ctx, "robot"); err != nil {
+		t.Errorf("robot denied: %v", err)
+	}
+	if err := CheckNamespace(ctx, "kube-system"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("kube-system = %v, want PermissionDenied", err)
+	}
+	if err := CheckNamespace(ctx, ""); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("all namespaces = %v, want PermissionDenied", err)
+	}
+	if err := CheckNamespace(context.Background(), "kube-system"); err != nil {
+		t.Errorf("unauthenticated server denied: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Backend is everything the gRPC server needs from one Kubernetes cluster.
+type Backend interface {
+	// Name is the cluster name requests select with their cluster field.
+	Name() string
+	Host() string
+
+	Ping(ctx context.Context) error
+	WaitReady(ctx context.Context) error
+	WatchInformers(ctx context.Context, resync time.Duration)
+	Close()
+
+	GetNodes(ctx context.Context) (*corev1.NodeList, error)
+	GetNode(ctx context.Context, name string) (*corev1.Node, error)
+	GetPods(ctx context.Context, namespace *string) (*corev1.PodList, error)
+	GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error)
+	GetPodLogs(ctx context.Context, namespace, name string) (*string, error)
+	ApplyYaml(ctx context.Context, yamlString string) (*string, error)
+	DeleteYaml(ctx context.Context, yamlString string) (*string, error)
+	PruneObjects(ctx context.Context, kinds, namespaces []string, selector string, keep []string, dryRun bool) ([]string, error)
+	GetObjects(ctx context.Context, kind, namespace, name, selector string) ([]map[string]interface{}, error)
+}
+
+var _ Backend = (*KubeController)(nil)
+
+// NewFakeKubeController returns a controller backed by an in-memory
+// clientset holding objects, for tests and offline use.
+func NewFakeKubeController(name string, objects ...runtime.Object) *KubeController {
+	return &KubeController{
+		Clientset: fake.NewSimpleClientset(objects...),
+		name:      name,
+		host:      "fake://" + name,
+	}
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func readCertificate(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("%s holds no PEM block", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestIssueCertificate(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateCA(dir, "test-ca", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	ca := readCertificate(t, filepath.Join(dir, "ca.crt"))
+	if !ca.IsCA || ca.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Errorf("CA IsCA = %v, KeyUsage = %v", ca.IsCA, ca.KeyUsage)
+	}
+
+	if err := IssueCertificate(dir, "robot1", []string{"192.168.5.10", "robot1.local"}, false, false, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	server := readCertificate(t, filepath.Join(dir, "robot1.crt"))
+	if !slices.Equal(server.DNSNames, []string{"robot1.local"}) {
+		t.Errorf("DNSNames = %v", server.DNSNames)
+	}
+	if len(server.IPAddresses) != 1 || !server.IPAddresses[0].Equal(net.ParseIP("192.168.5.10")) {
+		t.Errorf("IPAddresses = %v", server.IPAddresses)
+	}
+	if !slices.Equal(server.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) {
+		t.Errorf("server ExtKeyUsage = %v", server.ExtKeyUsage)
+	}
+	if server.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		t.Errorf("server KeyUsage = %v", server.KeyUsage)
+	}
+	if err := server.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("server certificate not signed by the CA: %v", err)
+	}
+
+	if err := IssueCertificate(dir, "kmctl", nil, true, false, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	client := readCertificate(t, filepath.Join(dir, "kmctl.crt"))
+	if !slices.Equal(client.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}) {
+		t.Errorf("client ExtKeyUsage = %v", client.ExtKeyUsage)
+	}
+	if len(client.DNSNames) != 0 || len(client.IPAddresses) != 0 {
+		t.Errorf("client SANs = %v %v", client.DNSNames, client.IPAddresses)
+	}
+}
+
+func TestIssueCertificateOverwrite(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateCA(dir, "test-ca", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	caKey, err := os.ReadFile(filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := IssueCertificate(dir, "ca", []string{"localhost"}, false, true, time.Hour); err == nil {
+		t.Error("issuing a certificate named ca succeeded")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "ca.key")); string(data) != string(caKey) {
+		t.Error("the CA key was replaced")
+	}
+
+	if err := IssueCertificate(dir, "robot1", []string{"localhost"}, false, false, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	first := readCertificate(t, filepath.Join(dir, "robot1.crt"))
+	if err := IssueCertificate(dir, "robot1", []string{"localhost"}, false, false, time.Hour); err == nil {
+		t.Error("reissuing robot1 without force succeeded")
+	}
+	if err := IssueCertificate(dir, "robot1", []string{"localhost"}, false, true, time.Hour); err != nil {
+		t.Fatalf("reissuing robot1 with force: %v", err)
+	}
+	if second := readCertificate(t, filepath.Join(dir, "robot1.crt")); second.SerialNumber.Cmp(first.SerialNumber) == 0 {
+		t.Error("robot1 was not reissued")
+	}
+}
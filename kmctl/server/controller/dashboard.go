@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log"
+	"net/http"
+	"slices"
+
+	"google.golang.org/grpc/status"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+type dashboard struct {
+	namespaces []string
+	auth       *Authenticator
+}
+
+type dashboardIdentity struct {
+	Name        string   `json:"name"`
+	Role        Role     `json:"role"`
+	AuthEnabled bool     `json:"authEnabled"`
+	Namespaces  []string `json:"namespaces"`
+}
+
+// NewDashboard serves the web UI under /ui/. The page calls the REST gateway
+// with the user's token, so roles are enforced by the gRPC server as for
+// kmctl. /ui/api/ adds the caller's identity. auth is nil when
+// authentication is disabled.
+func NewDashboard(namespaces []string, auth *Authenticator) http.Handler {
+	d := &dashboard{
+		namespaces: namespaces,
+		auth:       auth,
+	}
+
+	static, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		log.Fatalf("Failed to load dashboard: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/ui/", http.StripPrefix("/ui/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("GET /ui/api/whoami", d.whoami)
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"message": message})
+}
+
+// identity authenticates the request, or writes 401 and returns false.
+func (d *dashboard) identity(w http.ResponseWriter, r *http.Request) (*Identity, bool) {
+	if d.auth == nil {
+		return &Identity{Name: "anonymous", Role: RoleAdmin}, true
+	}
+
+	identity, err := d.auth.AuthenticateHTTP(r)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, status.Convert(err).Message())
+		return nil, false
+	}
+	return identity, true
+}
+
+func (d *dashboard) whoami(w http.ResponseWriter, r *http.Request) {
+	identity, ok := d.identity(w, r)
+	if !ok {
+		return
+	}
+
+	// suggest the namespaces the caller may use, else those the server serves
+	namespaces := identity.Namespaces
+	if len(namespaces) == 0 || slices.Contains(namespaces, "*") {
+		namespaces = d.namespaces
+	}
+	namespaces = slices.DeleteFunc(slices.Clone(namespaces), func(ns string) bool { return ns == "*" })
+
+	writeJSON(w, http.StatusOK, dashboardIdentity{
+		Name:        identity.Name,
+		Role:        identity.Role,
+		AuthEnabled: d.auth != nil,
+		Namespaces:  namespaces,
+	})
+}
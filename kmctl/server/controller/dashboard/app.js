@@ -0,0 +1,332 @@
+// Dashboard for one kube-backend server. Everything except the identity goes
+// through the REST gateway under /v1/, so the server enforces the caller's
+// role on every action.
+
+const state = {
+  token: sessionStorage.getItem("token") || "",
+  identity: null,
+  cluster: "",
+  tail: null,
+};
+
+const $ = (id) => document.getElementById(id);
+
+const OPERATOR_ROLES = ["operator", "admin"];
+const TAIL_INTERVAL = 2000;
+
+async function api(path, options = {}) {
+  const headers = { ...(options.headers || {}) };
+  if (state.token) {
+    headers.Authorization = "Bearer " + state.token;
+  }
+
+  const resp = await fetch(path, { ...options, headers });
+  const text = await resp.text();
+  if (resp.status === 401) {
+    showLogin();
+    throw new Error("Sign in required");
+  }
+
+  let body = {};
+  try {
+    body = text ? JSON.parse(text) : {};
+  } catch {
+    // streams are newline delimited JSON
+    body = text;
+  }
+  if (!resp.ok) {
+    throw new Error(body.message || resp.statusText);
+  }
+  return body;
+}
+
+function withCluster(path) {
+  if (!state.cluster) {
+    return path;
+  }
+  const sep = path.includes("?") ? "&" : "?";
+  return path + sep + "cluster=" + encodeURIComponent(state.cluster);
+}
+
+function showError(err) {
+  $("error").textContent = err ? err.message || String(err) : "";
+  $("error").hidden = !err;
+}
+
+function showLogin() {
+  $("login").hidden = false;
+  $("content").hidden = true;
+  $("logout").hidden = true;
+}
+
+function fillTable(id, rows) {
+  const tbody = $(id).querySelector("tbody");
+  tbody.replaceChildren(
+    ...rows.map((cells) => {
+      const tr = document.createElement("tr");
+      for (const cell of cells) {
+        const td = document.createElement("td");
+        if (cell instanceof Node) {
+          td.append(cell);
+        } else {
+          td.textContent = cell ?? "";
+        }
+        tr.append(td);
+      }
+      return tr;
+    }),
+  );
+}
+
+function button(label, onClick, className) {
+  const b = document.createElement("button");
+  b.textContent = label;
+  b.addEventListener("click", onClick);
+  if (className) {
+    b.className = className;
+  }
+  return b;
+}
+
+function canOperate() {
+  return state.identity && OPERATOR_ROLES.includes(state.identity.role);
+}
+
+async function loadIdentity() {
+  state.identity = await api("/ui/api/whoami");
+  $("login").hidden = true;
+  $("content").hidden = false;
+  $("logout").hidden = !state.identity.authEnabled;
+  $("identity").textContent = `${state.identity.name} (${state.identity.role})`;
+
+  for (const el of document.querySelectorAll(".operator")) {
+    el.hidden = !canOperate();
+  }
+
+  const namespaces = state.identity.namespaces || [];
+  $("namespaces").replaceChildren(
+    ...namespaces.map((ns) => {
+      const option = document.createElement("option");
+      option.value = ns;
+      return option;
+    }),
+  );
+  if (!$("namespace").value && namespaces.length > 0) {
+    $("namespace").value = namespaces[0];
+  }
+}
+
+async function loadClusters() {
+  const { clusters } = await api("/v1/clusters");
+  const select = $("cluster");
+  select.replaceChildren(
+    ...clusters.map((c) => {
+      const option = document.createElement("option");
+      option.value = c.name;
+      option.textContent = c.name + (c.ready ? "" : " (not ready)");
+      option.selected = c.default;
+      return option;
+    }),
+  );
+  state.cluster = select.value;
+}
+
+async function loadVersions() {
+  try {
+    const { components } = await api(withCluster("/v1/versions"));
+    fillTable(
+      "versions",
+      (components || []).map((c) => [c.name, c.version || "-", c.updatedAt || "-"]),
+    );
+  } catch (err) {
+    fillTable("versions", [[err.message, "", ""]]);
+  }
+}
+
+async function loadNodes() {
+  const { nodes } = await api(withCluster("/v1/nodes"));
+  fillTable(
+    "nodes",
+    nodes.map((n) => [n.name, n.ip, n.arch, n.kernelVersion]),
+  );
+}
+
+async function loadPods() {
+  const namespace = $("namespace").value.trim();
+  const path = namespace
+    ? `/v1/namespaces/${encodeURIComponent(namespace)}/pods`
+    : "/v1/pods";
+  const { pods } = await api(withCluster(path));
+
+  fillTable(
+    "pods",
+    pods.map((p) => {
+      const status = document.createElement("span");
+      status.textContent = p.status;
+      status.className = "status-" + p.status;
+
+      const actions = document.createElement("span");
+      actions.append(button("Logs", () => startTail(p.namespace, p.name)));
+      if (canOperate()) {
+        actions.append(
+          button("Delete", () => deletePod(p.namespace, p.name), "danger"),
+        );
+      }
+      return [p.name, p.namespace, status, p.image, actions];
+    }),
+  );
+}
+
+// parseLogStream joins the log chunks of a GetPodLogs response.
+function parseLogStream(body) {
+  const text = typeof body === "string" ? body : JSON.stringify(body);
+  let logs = "";
+  for (const line of text.split("\n")) {
+    if (!line.trim()) {
+      continue;
+    }
+    const chunk = JSON.parse(line);
+    if (chunk.error) {
+      throw new Error(chunk.error.message);
+    }
+    logs += chunk.result.log;
+  }
+  return logs;
+}
+
+async function fetchLogs(namespace, name) {
+  const path = `/v1/namespaces/${encodeURIComponent(namespace)}/pods/${encodeURIComponent(name)}/logs`;
+  return parseLogStream(await api(withCluster(path)));
+}
+
+// startTail shows the logs of a pod and appends new lines every two seconds.
+function startTail(namespace, name) {
+  stopTail();
+  $("logs").hidden = false;
+  $("logs-pod").textContent = `${namespace}/${name}`;
+  const output = $("logs-output");
+  output.textContent = "";
+
+  let previous = "";
+  const poll = async () => {
+    try {
+      const logs = await fetchLogs(namespace, name);
+      const atBottom =
+        output.scrollTop + output.clientHeight >= output.scrollHeight - 4;
+      if (logs.startsWith(previous)) {
+        output.append(logs.slice(previous.length));
+      } else {
+        output.textContent = logs;
+      }
+      previous = logs;
+      if (atBottom) {
+        output.scrollTop = output.scrollHeight;
+      }
+      showError(null);
+    } catch (err) {
+      showError(err);
+    }
+  };
+
+  poll();
+  state.tail = setInterval(poll, TAIL_INTERVAL);
+}
+
+function stopTail() {
+  if (state.tail) {
+    clearInterval(state.tail);
+    state.tail = null;
+  }
+}
+
+async function sendManifest(action, yaml) {
+  const body = { yaml, cluster: state.cluster };
+  const result = await api("/v1/" + action, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+  return result.message;
+}
+
+async function deletePod(namespace, name) {
+  if (!confirm(`Delete pod ${namespace}/${name} on ${state.cluster}?`)) {
+    return;
+  }
+  const yaml = `apiVersion: v1\nkind: Pod\nmetadata:\n  name: ${name}\n  namespace: ${namespace}\n`;
+  try {
+    await sendManifest("delete", yaml);
+    await loadPods();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function manifestAction(action) {
+  const yaml = $("manifest").value;
+  if (!yaml.trim()) {
+    return;
+  }
+  if (action === "delete" && !confirm(`Delete these objects on ${state.cluster}?`)) {
+    return;
+  }
+  try {
+    $("manifest-result").textContent = await sendManifest(action, yaml);
+    showError(null);
+    await loadPods();
+  } catch (err) {
+    $("manifest-result").textContent = "";
+    showError(err);
+  }
+}
+
+async function refresh() {
+  try {
+    await Promise.all([loadVersions(), loadNodes(), loadPods()]);
+    showError(null);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+async function start() {
+  try {
+    await loadIdentity();
+    await loadClusters();
+    await refresh();
+  } catch (err) {
+    showError(err);
+  }
+}
+
+$("login").addEventListener("submit", (e) => {
+  e.preventDefault();
+  state.token = $("token").value;
+  sessionStorage.setItem("token", state.token);
+  start();
+});
+
+$("logout").addEventListener("click", () => {
+  stopTail();
+  state.token = "";
+  sessionStorage.removeItem("token");
+  showLogin();
+});
+
+$("cluster").addEventListener("change", (e) => {
+  stopTail();
+  $("logs").hidden = true;
+  state.cluster = e.target.value;
+  refresh();
+});
+
+$("pods-form").addEventListener("submit", (e) => {
+  e.preventDefault();
+  loadPods().catch(showError);
+});
+
+$("logs-stop").addEventListener("click", stopTail);
+$("apply").addEventListener("click", () => manifestAction("apply"));
+$("delete").addEventListener("click", () => manifestAction("delete"));
+
+start();
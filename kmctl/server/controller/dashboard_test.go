@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func dashboardGet(t *testing.T, handler http.Handler, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDashboard(t *testing.T) {
+	auth, _ := newTestAuthenticator(t)
+	handler := NewDashboard([]string{"robot", "default"}, auth)
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		code  int
+		want  string
+	}{
+		{"page", "/ui/", "", http.StatusOK, "<title>kube-backend</title>"},
+		{"script", "/ui/app.js", "", http.StatusOK, "/v1/clusters"},
+		{"whoami without token", "/ui/api/whoami", "", http.StatusUnauthorized, "bearer token"},
+		{"viewer", "/ui/api/whoami", "viewer-token", http.StatusOK, `"role":"viewer","authEnabled":true,"namespaces":["robot","default"]`},
+		{"limited operator", "/ui/api/whoami", "operator-token", http.StatusOK, `"role":"operator","authEnabled":true,"namespaces":["robot"]`},
+		{"versions through the gateway", "/ui/app.js", "", http.StatusOK, "/v1/versions"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := dashboardGet(t, handler, tt.path, tt.token)
+			if rec.Code != tt.code {
+				t.Errorf("status = %d, want %d", rec.Code, tt.code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.want) {
+				t.Errorf("body does not contain %s:\n%s", tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDashboardWithoutAuth(t *testing.T) {
+	handler := NewDashboard(nil, nil)
+
+	rec := dashboardGet(t, handler, "/ui/api/whoami", "")
+	if !strings.Contains(rec.Body.String(), `"role":"admin","authEnabled":false`) {
+		t.Errorf("whoami without auth = %s", rec.Body.String())
+	}
+}
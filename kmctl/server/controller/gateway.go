@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	pb "com.kubebackend/m/proto"
+)
+
+const eventStreamMIME = "text/event-stream"
+
+// eventStreamMarshaler writes every message as a server-sent event. The
+// gateway picks it for requests with "Accept: text/event-stream".
+type eventStreamMarshaler struct {
+	runtime.JSONPb
+}
+
+func (m *eventStreamMarshaler) Marshal(v interface{}) ([]byte, error) {
+	data, err := m.JSONPb.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte("data: "), data...), nil
+}
+
+func (m *eventStreamMarshaler) ContentType(interface{}) string {
+	return eventStreamMIME
+}
+
+func (m *eventStreamMarshaler) Delimiter() []byte {
+	return []byte("\n\n")
+}
+
+// NewGateway serves the KubeBackend service as REST/JSON under /v1/ and its
+// OpenAPI spec on /openapi.json. Calls go through conn, normally that of
+// ServeGateway, so they pass the same interceptors as gRPC clients. Streams are sent as newline delimited
+// JSON, or as server-sent events when the client accepts them.
+func NewGateway(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	jsonpb := runtime.JSONPb{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+
+	gateway := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.HTTPBodyMarshaler{Marshaler: &jsonpb}),
+		runtime.WithMarshalerOption(eventStreamMIME, &eventStreamMarshaler{JSONPb: jsonpb}),
+		runtime.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+			return metadata.Pairs(gatewayRemoteAddr, r.RemoteAddr)
+		}),
+	)
+	if err := pb.RegisterKubeBackendHandler(ctx, gateway, conn); err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", gateway)
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(pb.OpenAPI)
+	})
+
+	return mux, nil
+}
+
+// gatewayRemoteAddr is the metadata key of the HTTP client address the
+// gateway forwards to the gRPC server.
+const gatewayRemoteAddr = "x-gateway-remote-addr"
+
+type remoteAddrKey struct{}
+
+// ServeGateway serves s to the gateway on an in-process connection. The
+// connection never leaves the process, so it needs no TLS and no client
+// certificate even when gRPC clients must present one. opts should carry
+// the interceptors of the gRPC server; calls through the gateway take the
+// address of the HTTP client from its metadata.
+func ServeGateway(s pb.KubeBackendServer, opts ...grpc.ServerOption) (*grpc.Server, *grpc.ClientConn, error) {
+	opts = append([]grpc.ServerOption{grpc.ChainUnaryInterceptor(gatewayUnaryInterceptor)}, opts...)
+	grpcServer := grpc.NewServer(opts...)
+	pb.RegisterKubeBackendServer(grpcServer, s)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go grpcServer.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///gateway",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		grpcServer.Stop()
+		return nil, nil, err
+	}
+
+	return grpcServer, conn, nil
+}
+
+// gatewayUnaryInterceptor keeps the HTTP client address for the auditor. It
+// only runs on the in-process server, so clients can not spoof it over gRPC.
+func gatewayUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	// the gateway appends its value after those forwarded from HTTP headers
+	if values := md.Get(gatewayRemoteAddr); len(values) > 0 {
+		ctx = context.WithValue(ctx, remoteAddrKey{}, values[len(values)-1])
+	}
+
+	return handler(ctx, req)
+}
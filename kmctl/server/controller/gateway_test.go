@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"com.kubebackend/m/client/controller"
+	"com.kubebackend/m/server/model"
+)
+
+func newTestGateway(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	backend := NewFakeKubeController("sim-01", &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "navigation-0", Namespace: "robot"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "navigation", Image: "navigation"}}},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	})
+	config := &model.Config{
+		Database:   filepath.Join(t.TempDir(), "test.db"),
+		Components: []model.Component{{Name: "NAVIGATION", Table: "navigations"}},
+	}
+	s, err := NewServerWithBackends(config, []Backend{backend})
+	if err != nil {
+		t.Fatalf("NewServerWithBackends: %v", err)
+	}
+
+	server := httptest.NewServer(newGatewayHandler(t, s))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newGatewayHandler serves s to a gateway in process like serve does.
+func newGatewayHandler(t *testing.T, s *server, opts ...grpc.ServerOption) http.Handler {
+	t.Helper()
+
+	grpcServer, conn, err := ServeGateway(s, opts...)
+	if err != nil {
+		t.Fatalf("ServeGateway: %v", err)
+	}
+	t.Cleanup(grpcServer.Stop)
+	t.Cleanup(func() { conn.Close() })
+
+	handler, err := NewGateway(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("NewGateway: %v", err)
+	}
+
+	return handler
+}
+
+func gatewayGet(t *testing.T, url, accept string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestGateway(t *testing.T) {
+	server := newTestGateway(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		want   []string
+	}{
+		{"clusters", "/v1/clusters", "", []string{`"name":"sim-01"`, `"default":true`}},
+		{"pods", "/v1/namespaces/robot/pods", "", []string{`"name":"navigation-0"`, `"status":"Running"`}},
+		{"pod", "/v1/namespaces/robot/pods/navigation-0?cluster=sim-01", "", []string{`"image":"navigation"`}},
+		{"logs", "/v1/namespaces/robot/pods/navigation-0/logs", "", []string{`{"result":{"log":"fake logs"}}`}},
+		{"logs as events", "/v1/namespaces/robot/pods/navigation-0/logs", "text/event-stream", []string{`data: {"result":{"log":"fake logs"}}` + "\n\n"}},
+		{"versions", "/v1/versions?cluster=sim-01", "", []string{`"components":[{"name":"NAVIGATION"`, `"cluster":"sim-01"`}},
+		{"openapi", "/openapi.json", "", []string{`"/v1/namespaces/{namespace}/pods/{name}/logs"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := gatewayGet(t, server.URL+tt.path, tt.accept)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, body %s", resp.StatusCode, body)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(strings.ReplaceAll(body, ", ", ","), want) {
+					t.Errorf("body does not contain %s:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestGatewayApply(t *testing.T) {
+	server := newTestGateway(t)
+
+	body := `{"yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: navigation\n  namespace: robot\n"}`
+	resp, err := http.Post(server.URL+"/v1/apply", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("apply status = %d", resp.StatusCode)
+	}
+
+	resp, _ = gatewayGet(t, server.URL+"/v1/nodes?cluster=nope", "")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown cluster status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestGatewayMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	if err := GenerateCA(dir, "test-ca", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	// certificates as issued by the certs command: server auth only for the
+	// server, client auth only for kmctl
+	if err := IssueCertificate(dir, "robot1", []string{"127.0.0.1"}, false, false, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := IssueCertificate(dir, "kmctl", nil, true, false, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := newUpgradeServer(t)
+	auditor := NewAuditor(s.DB(), s.DefaultCluster())
+	server := httptest.NewUnstartedServer(newGatewayHandler(t, s, grpc.ChainUnaryInterceptor(auditor.UnaryInterceptor())))
+	var err error
+	server.TLS, err = ServerTLSConfig(filepath.Join(dir, "robot1.crt"), filepath.Join(dir, "robot1.key"), filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots, err := loadCertPool(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "kmctl.crt"), filepath.Join(dir, "kmctl.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	if _, err := newClient().Get(server.URL + "/v1/clusters"); err == nil {
+		t.Error("request without a client certificate succeeded")
+	}
+
+	var clientAddr string
+	trace := &httptrace.ClientTrace{GotConn: func(info httptrace.GotConnInfo) {
+		clientAddr = info.Conn.LocalAddr().String()
+	}}
+	body := `{"yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: navigation\n  namespace: robot\n"}`
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodPost, server.URL+"/v1/apply", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newClient(cert).Do(req)
+	if err != nil {
+		t.Fatalf("apply with a client certificate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("apply status = %d", resp.StatusCode)
+	}
+
+	var audits []controller.Audit
+	if err := s.DB().GetAudits(&controller.AuditFilter{}, &audits); err != nil {
+		t.Fatal(err)
+	}
+	if len(audits) != 1 || audits[0].Peer_addr != clientAddr {
+		t.Errorf("audits = %+v, want one from %s", audits, clientAddr)
+	}
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	pb "com.kubebackend/m/proto"
+)
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// WatchHealth polls the Kubernetes API server every interval and reports the
+// result through the gRPC health service, for the whole server ("") and for
+// the KubeBackend service. It returns when ctx is cancelled.
+func WatchHealth(ctx context.Context, pinger Pinger, healthServer *health.Server, interval time.Duration) {
+	services := []string{"", pb.KubeBackend_ServiceDesc.ServiceName}
+	last := healthpb.HealthCheckResponse_UNKNOWN
+
+	check := func() {
+		pingCtx, cancel := context.WithTimeout(ctx, interval)
+		defer cancel()
+
+		status := healthpb.HealthCheckResponse_SERVING
+		if err := pinger.Ping(pingCtx); err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			if last != status {
+				slog.Warn("Kubernetes API is unreachable", "err", err)
+			}
+		} else if last == healthpb.HealthCheckResponse_NOT_SERVING {
+			log.Printf("Kubernetes API is reachable again")
+		}
+
+		for _, service := range services {
+			healthServer.SetServingStatus(service, status)
+		}
+		last = status
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	check()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	pb "com.kubebackend/m/proto"
+)
+
+// fakePinger reaches the Kubernetes API while reachable is set.
+type fakePinger struct {
+	reachable atomic.Bool
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	if !p.reachable.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+// serveHealth serves healthServer on its own gRPC server, like the main port
+// or the plaintext health port, and returns a client for it.
+func serveHealth(t *testing.T, healthServer *health.Server) healthpb.HealthClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///health",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return healthpb.NewHealthClient(conn)
+}
+
+func waitForHealth(t *testing.T, client healthpb.HealthClient, service string, want healthpb.HealthCheckResponse_ServingStatus) {
+	t.Helper()
+
+	var got healthpb.HealthCheckResponse_ServingStatus
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		resp, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q): %v", service, err)
+		}
+		if got = resp.Status; got == want {
+			return
+		}
+	}
+	t.Fatalf("Check(%q) = %v, want %v", service, got, want)
+}
+
+func TestWatchHealth(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pinger := &fakePinger{}
+	pinger.reachable.Store(true)
+	healthServer := health.NewServer()
+	go WatchHealth(ctx, pinger, healthServer, 10*time.Millisecond)
+
+	clients := map[string]healthpb.HealthClient{
+		"main port":   serveHealth(t, healthServer),
+		"health port": serveHealth(t, healthServer),
+	}
+	services := []string{"", pb.KubeBackend_ServiceDesc.ServiceName}
+
+	for _, want := range []healthpb.HealthCheckResponse_ServingStatus{
+		healthpb.HealthCheckResponse_SERVING,
+		healthpb.HealthCheckResponse_NOT_SERVING,
+		healthpb.HealthCheckResponse_SERVING,
+	} {
+		pinger.reachable.Store(want == healthpb.HealthCheckResponse_SERVING)
+		for name, client := range clients {
+			for _, service := range services {
+				label := service
+				if label == "" {
+					label = "overall"
+				}
+				t.Run(name+"/"+label+"/"+want.String(), func(t *testing.T) {
+					waitForHealth(t, client, service, want)
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"com.kubebackend/m/client/controller"
+	pb "com.kubebackend/m/proto"
+)
+
+// recordInventory saves every object of yamlString as applied to cluster by
+// the caller, as part of applySet if it is not empty. Failures are logged,
+// since the objects are already applied.
+func (s *server) recordInventory(ctx context.Context, cluster, yamlString, source, applySet string) {
+	if s.db == nil {
+		return
+	}
+
+	documents, err := splitYaml(yamlString)
+	if err != nil {
+		slog.Error("Failed to record inventory", "err", err)
+		return
+	}
+
+	appliedBy := "anonymous"
+	if identity, ok := IdentityFromContext(ctx); ok {
+		appliedBy = identity.Name
+	}
+	appliedAt := time.Now().UTC()
+
+	for _, document := range documents {
+		objects, _ := getYamlObjects(document)
+		if len(objects) == 0 {
+			continue
+		}
+		kind, namespace, name := splitObject(objects[0])
+		sum := sha256.Sum256([]byte(document))
+
+		inventory := controller.Inventory{
+			Cluster:       cluster,
+			Kind:          kind,
+			Namespace:     namespace,
+			Name:          name,
+			Manifest_hash: hex.EncodeToString(sum[:]),
+			Applied_by:    appliedBy,
+			Source:        source,
+			Apply_set:     applySet,
+			Applied_at:    appliedAt,
+		}
+		if err := s.db.SaveInventory(&inventory); err != nil {
+			slog.Error("Failed to record inventory", "object", objects[0], "err", err)
+		}
+	}
+}
+
+// forgetInventory removes deleted objects ("Kind/namespace/name") from the
+// inventory of cluster.
+func (s *server) forgetInventory(cluster string, objects []string) {
+	if s.db == nil {
+		return
+	}
+
+	for _, object := range objects {
+		kind, namespace, name := splitObject(object)
+		if err := s.db.DeleteInventory(&cluster, &kind, &namespace, &name); err != nil {
+			slog.Error("Failed to remove from inventory", "object", object, "err", err)
+		}
+	}
+}
+
+// applySetNamespaces returns the namespaces of the objects stored for the
+// apply set on cluster, which may be gone from its latest manifest. Those the
+// caller may not use are left out.
+func (s *server) applySetNamespaces(ctx context.Context, cluster, applySet string) []string {
+	if s.db == nil {
+		return nil
+	}
+
+	var entries []controller.Inventory
+	if err := s.db.GetInventory(&controller.InventoryFilter{Cluster: cluster, ApplySet: applySet}, &entries); err != nil {
+		slog.Error("Failed to get the namespaces of apply set", "applySet", applySet, "err", err)
+		return nil
+	}
+
+	var namespaces []string
+	for _, entry := range entries {
+		if s.checkNamespace(ctx, entry.Namespace) != nil {
+			slog.Warn("Not pruning apply set of another caller", "applySet", applySet, "namespace", entry.Namespace)
+			continue
+		}
+		namespaces = append(namespaces, entry.Namespace)
+	}
+
+	return namespaces
+}
+
+func splitObject(object string) (string, string, string) {
+	kind, rest, _ := strings.Cut(object, "/")
+	namespace, name, _ := strings.Cut(rest, "/")
+	return kind, namespace, name
+}
+
+func (s *server) GetInventory(ctx context.Context, in *pb.GetInventoryRequest) (*pb.Inventory, error) {
+	if s.db == nil {
+		slog.Warn("Database is not available")
+		return nil, fmt.Errorf("database is not available")
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to get inventory", "err", err)
+		return nil, err
+	}
+	if in.Namespace != "" {
+		if err := s.checkNamespace(ctx, in.Namespace); err != nil {
+			slog.Error("Failed to get inventory", "err", err)
+			return nil, err
+		}
+	}
+
+	filter := controller.InventoryFilter{
+		Cluster:   kubeCon.Name(),
+		Kind:      in.Kind,
+		Namespace: in.Namespace,
+	}
+
+	var entries []controller.Inventory
+	if err := s.db.GetInventory(&filter, &entries); err != nil {
+		slog.Error("Failed to get inventory", "err", err)
+		return nil, err
+	}
+
+	var inventory pb.Inventory
+	for _, entry := range entries {
+		// hide the objects of namespaces the caller may not use
+		if s.checkNamespace(ctx, entry.Namespace) != nil {
+			continue
+		}
+
+		inventory.Entries = append(inventory.Entries, &pb.InventoryEntry{
+			Kind:         entry.Kind,
+			Namespace:    entry.Namespace,
+			Name:         entry.Name,
+			ManifestHash: entry.Manifest_hash,
+			AppliedBy:    entry.Applied_by,
+			Source:       entry.Source,
+			AppliedAt:    timestamppb.New(entry.Applied_at),
+			Cluster:      entry.Cluster,
+		})
+	}
+
+	log.Printf("GetInventoryResponse: %d entries", len(inventory.Entries))
+
+	return &inventory, nil
+}
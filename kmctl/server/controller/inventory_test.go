@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
+)
+
+func TestInventory(t *testing.T) {
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{NewFakeKubeController("sim-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), identityKey{}, &Identity{Name: "release-bot", Role: RoleOperator, Namespaces: []string{"*"}})
+	service := "apiVersion: v1\nkind: Service\nmetadata:\n  name: navigation\n  namespace: robot\n"
+	if _, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: testDeployment + "---\n" + service, Source: "stack.yaml"}); err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+
+	inventory, err := s.GetInventory(ctx, &pb.GetInventoryRequest{})
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if len(inventory.Entries) != 2 {
+		t.Fatalf("entries = %v, want the deployment and the service", inventory.Entries)
+	}
+	deployment := inventory.Entries[0]
+	if deployment.Kind != "Deployment" || deployment.Name != "navigation" || deployment.Namespace != "robot" ||
+		deployment.AppliedBy != "release-bot" || deployment.Source != "stack.yaml" || deployment.Cluster != "sim-01" || len(deployment.ManifestHash) != 64 {
+		t.Errorf("deployment entry = %v", deployment)
+	}
+
+	// a new manifest replaces the entry
+	updated := strings.Replace(testDeployment, "24.12.3", "24.12.4", 1)
+	if _, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: updated, Source: "navigation.yaml"}); err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	inventory, _ = s.GetInventory(ctx, &pb.GetInventoryRequest{Kind: "Deployment"})
+	if len(inventory.Entries) != 1 || inventory.Entries[0].ManifestHash == deployment.ManifestHash || inventory.Entries[0].Source != "navigation.yaml" {
+		t.Errorf("entries after update = %v", inventory.Entries)
+	}
+
+	if _, err := s.DeleteYaml(ctx, &pb.ApplyYamlRequest{Yaml: service}); err != nil {
+		t.Fatalf("DeleteYaml: %v", err)
+	}
+	inventory, _ = s.GetInventory(ctx, &pb.GetInventoryRequest{})
+	if len(inventory.Entries) != 1 || inventory.Entries[0].Kind != "Deployment" {
+		t.Errorf("entries after delete = %v", inventory.Entries)
+	}
+
+	limited := context.WithValue(context.Background(), identityKey{}, &Identity{Name: "viewer", Role: RoleViewer, Namespaces: []string{"default"}})
+	inventory, _ = s.GetInventory(limited, &pb.GetInventoryRequest{})
+	if len(inventory.Entries) != 0 {
+		t.Errorf("entries outside the caller's namespaces = %v", inventory.Entries)
+	}
+}
+
+func TestInventoryPartialApply(t *testing.T) {
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{NewFakeKubeController("sim-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.WithValue(context.Background(), identityKey{}, &Identity{Name: "release-bot", Role: RoleOperator, Namespaces: []string{"*"}})
+	unknown := "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: navigation\n  namespace: robot\n"
+	if _, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: testDeployment + "---\n" + unknown, Source: "stack.yaml"}); err == nil {
+		t.Fatal("applying an unknown kind succeeded")
+	}
+
+	inventory, err := s.GetInventory(ctx, &pb.GetInventoryRequest{})
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if len(inventory.Entries) != 1 || inventory.Entries[0].Kind != "Deployment" {
+		t.Errorf("entries = %v, want the deployment applied before the failure", inventory.Entries)
+	}
+}
+
+func TestInventoryNamespaceFilter(t *testing.T) {
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{NewFakeKubeController("sim-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), identityKey{}, &Identity{Name: "release-bot", Role: RoleOperator, Namespaces: []string{"*"}})
+	service := "apiVersion: v1\nkind: Service\nmetadata:\n  name: navigation\n  namespace: default\n"
+	if _, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: testDeployment + "---\n" + service, Source: "stack.yaml"}); err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+
+	auth, _ := newTestAuthenticator(t)
+	info := &grpc.UnaryServerInfo{FullMethod: pb.KubeBackend_GetInventory_FullMethodName}
+	getInventory := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return s.GetInventory(ctx, req.(*pb.GetInventoryRequest))
+	}
+
+	// bob may only use robot, so all namespaces are filtered down to it
+	resp, err := auth.UnaryInterceptor()(bearerContext("operator-token"), &pb.GetInventoryRequest{}, info, getInventory)
+	if err != nil {
+		t.Fatalf("GetInventory: %v", err)
+	}
+	if entries := resp.(*pb.Inventory).Entries; len(entries) != 1 || entries[0].Namespace != "robot" {
+		t.Errorf("entries = %v, want only robot", entries)
+	}
+
+	if _, err := auth.UnaryInterceptor()(bearerContext("operator-token"), &pb.GetInventoryRequest{Namespace: "default"}, info, getInventory); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("GetInventory of default: %v", err)
+	}
+}
@@ -3,13 +3,15 @@ package controller
 import (
 	"context"
 	"encoding/json"
-	"flag"
 	"fmt"
 	"io"
+	"log"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -17,117 +19,231 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	kubeyaml "k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 
 	"gopkg.in/yaml.v3"
 )
 
+// KubeController is the Backend of a cluster reached through a client-go
+// clientset, either a real one or an in-memory fake.
 type KubeController struct {
-	Clientset *kubernetes.Clientset
+	Clientset kubernetes.Interface
+	// name is the kubeconfig context, or "in-cluster"
+	name string
+	host string
 }
 
-func GetKubeClient(path *string) (*kubernetes.Clientset, error) {
-	kubeHostEnv := os.Getenv("KUBERNETES_SERVICE_HOST")
+// InClusterName is the cluster name used for the in-cluster config.
+const InClusterName = "in-cluster"
 
-	var clientset *kubernetes.Clientset
+// pingTimeout bounds each readiness check of an API server.
+const pingTimeout = 5 * time.Second
 
-	if kubeHostEnv == "" {
-		var kubeconfig string
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
-		} else {
-			kubeconfig = *path
-		}
-		flag.Parse()
+// connectBackoff is how long WaitReady waits for the API server at startup,
+// up to about a minute with pingTimeout.
+var connectBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    7,
+	Cap:      15 * time.Second,
+}
 
-		// use the current context in kubeconfig
-		config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			panic(err.Error())
+// GetKubeConfig resolves the Kubernetes client config in this order:
+//  1. the kubeconfig path given on the command line or in the config file
+//  2. $KUBECONFIG, merging every file in the list
+//  3. the in-cluster service account when running in a pod
+//  4. $HOME/.kube/config
+//
+// kubeContext selects a context from the kubeconfig instead of its
+// current-context. It cannot be used with the in-cluster config. The name of
+// the context in use is returned with the config.
+func GetKubeConfig(kubeconfig, kubeContext string) (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+
+	if kubeconfig == "" && os.Getenv(clientcmd.RecommendedConfigPathEnvVar) == "" && os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if kubeContext != "" {
+			return nil, "", fmt.Errorf("context %s requires a kubeconfig, but the server is running in a cluster", kubeContext)
 		}
 
-		// create the clientset
-		clientset, err = kubernetes.NewForConfig(config)
-		if err != nil {
-			panic(err.Error())
-		}
-	} else {
 		config, err := rest.InClusterConfig()
 		if err != nil {
-			slog.Error("Failed to get k8s config: " + err.Error())
-			return nil, err
+			return nil, "", fmt.Errorf("failed to load in-cluster config: %w", err)
 		}
+		log.Printf("Using in-cluster config")
+		return config, InClusterName, nil
+	}
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	paths := strings.Join(rules.GetLoadingPrecedence(), string(filepath.ListSeparator))
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig %s: %w", paths, err)
+	}
 
-		clientset, err = kubernetes.NewForConfig(config)
+	current := kubeContext
+	if current == "" {
+		rawConfig, err := clientConfig.RawConfig()
 		if err != nil {
-			slog.Error("Failed to create k8s client: %v" + err.Error())
-			return nil, err
+			return nil, "", fmt.Errorf("failed to load kubeconfig %s: %w", paths, err)
 		}
+		current = rawConfig.CurrentContext
+	}
+	log.Printf("Using kubeconfig %s (context %s)", paths, current)
+
+	return config, current, nil
+}
+
+// GetKubeContexts returns every context in the kubeconfig resolved like
+// GetKubeConfig, sorted by name.
+func GetKubeContexts(kubeconfig string) ([]string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+
+	rawConfig, err := rules.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	var contexts []string
+	for name := range rawConfig.Contexts {
+		contexts = append(contexts, name)
+	}
+	sort.Strings(contexts)
+
+	return contexts, nil
+}
+
+func GetKubeClient(kubeconfig, kubeContext string) (*kubernetes.Clientset, *rest.Config, string, error) {
+	config, name, err := GetKubeConfig(kubeconfig, kubeContext)
+	if err != nil {
+		slog.Error("Failed to get k8s config", "err", err)
+		return nil, nil, "", err
 	}
-	return clientset, nil
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		slog.Error("Failed to create k8s client", "err", err)
+		return nil, nil, "", err
+	}
+
+	return clientset, config, name, nil
 }
 
-func NewKubeController(path *string) (*KubeController, error) {
-	clientset, err := GetKubeClient(path)
+func NewKubeController(kubeconfig, kubeContext string) (*KubeController, error) {
+	clientset, config, name, err := GetKubeClient(kubeconfig, kubeContext)
 	if err != nil {
-		slog.Error("Failed to create k8s client: %v" + err.Error())
+		slog.Error("Failed to create k8s client", "err", err)
 		return nil, err
 	}
 
 	return &KubeController{
 		Clientset: clientset,
+		name:      name,
+		host:      config.Host,
 	}, nil
 }
 
-func (k *KubeController) GetNodes() (*corev1.NodeList, error) {
-	nodes, err := k.Clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+func (k *KubeController) Name() string {
+	return k.name
+}
+
+func (k *KubeController) Host() string {
+	return k.host
+}
+
+// WaitReady pings the API server with exponential backoff until it answers,
+// ctx is cancelled or the retries run out.
+func (k *KubeController) WaitReady(ctx context.Context) error {
+	var lastErr error
+	err := wait.ExponentialBackoffWithContext(ctx, connectBackoff, func(ctx context.Context) (bool, error) {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		defer cancel()
+
+		lastErr = k.Ping(pingCtx)
+		if lastErr != nil {
+			slog.Warn("Kubernetes API is not ready, retrying", "cluster", k.name, "err", lastErr)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil && lastErr != nil {
+		return lastErr
+	}
+
+	return err
+}
+
+// Close drops the idle connections to the Kubernetes API server.
+func (k *KubeController) Close() {
+	if restClient, ok := k.Clientset.CoreV1().RESTClient().(*rest.RESTClient); ok && restClient != nil && restClient.Client != nil {
+		restClient.Client.CloseIdleConnections()
+	}
+}
+
+func (k *KubeController) Ping(ctx context.Context) error {
+	restClient := k.Clientset.Discovery().RESTClient()
+	if restClient == nil {
+		// fake clientsets have no REST client
+		_, err := k.Clientset.Discovery().ServerVersion()
+		return err
+	}
+
+	return restClient.Get().AbsPath("/readyz").Do(ctx).Error()
+}
+
+func (k *KubeController) GetNodes(ctx context.Context) (*corev1.NodeList, error) {
+	nodes, err := k.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
 	if err != nil {
-		slog.Error("Failed to list nodes: %v" + err.Error())
+		slog.Error("Failed to list nodes", "err", err)
 		return nil, err
 	}
 
 	return nodes, nil
 }
 
-func (k *KubeController) GetNode(name string) (*corev1.Node, error) {
-	node, err := k.Clientset.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+func (k *KubeController) GetNode(ctx context.Context, name string) (*corev1.Node, error) {
+	node, err := k.Clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		slog.Error("Failed to get node: %v" + err.Error())
+		slog.Error("Failed to get node", "err", err)
 		return &corev1.Node{}, err
 	}
 
 	return node, nil
 }
 
-func (k *KubeController) GetPods(namespace *string) (*corev1.PodList, error) {
-	pods, err := k.Clientset.CoreV1().Pods(*namespace).List(context.TODO(), metav1.ListOptions{})
+func (k *KubeController) GetPods(ctx context.Context, namespace *string) (*corev1.PodList, error) {
+	pods, err := k.Clientset.CoreV1().Pods(*namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
-		slog.Error("Failed to list pods: %v" + err.Error())
+		slog.Error("Failed to list pods", "err", err)
 		return nil, err
 	}
 
 	return pods, nil
 }
 
-func (k *KubeController) GetPod(namespace, name string) (*corev1.Pod, error) {
-	pod, err := k.Clientset.CoreV1().Pods(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+func (k *KubeController) GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	pod, err := k.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
-		slog.Error("Failed to get pod: %v" + err.Error())
+		slog.Error("Failed to get pod", "err", err)
 		return &corev1.Pod{}, err
 	}
 
 	return pod, nil
 }
 
-func (k *KubeController) GetPodLogs(namespace, name string) (*string, error) {
+func (k *KubeController) GetPodLogs(ctx context.Context, namespace, name string) (*string, error) {
 	podLogOptions := corev1.PodLogOptions{}
 	req := k.Clientset.CoreV1().Pods(namespace).GetLogs(name, &podLogOptions)
-	podLogs, err := req.Stream(context.Background())
+	podLogs, err := req.Stream(ctx)
 	if err != nil {
-		slog.Error("Failed to get pod logs: %v" + err.Error())
+		slog.Error("Failed to get pod logs", "err", err)
 		return nil, err
 	}
 	defer podLogs.Close()
@@ -135,7 +251,7 @@ func (k *KubeController) GetPodLogs(namespace, name string) (*string, error) {
 	buf := new(strings.Builder)
 	_, err = io.Copy(buf, podLogs)
 	if err != nil {
-		slog.Error("Failed to copy pod logs: %v" + err.Error())
+		slog.Error("Failed to copy pod logs", "err", err)
 		return nil, err
 	}
 
@@ -149,43 +265,187 @@ func getYamlKind(yamlString string) (*string, error) {
 	yamlContent := make(map[string]interface{})
 	err := yamlDecoder.Decode(&yamlContent)
 	if err != nil {
-		slog.Error("Failed to decode yaml: %v" + err.Error())
+		slog.Error("Failed to decode yaml", "err", err)
 		return nil, err
 	}
 
-	result := yamlContent["kind"].(string)
+	result, ok := yamlContent["kind"].(string)
+	if !ok || result == "" {
+		return nil, fmt.Errorf("yaml has no kind")
+	}
 
 	return &result, nil
 }
 
+// getYamlNamespaces returns the namespace of every document in yamlString.
+func getYamlNamespaces(yamlString string) ([]string, error) {
+	yamlDecoder := yaml.NewDecoder(strings.NewReader(yamlString))
+
+	var namespaces []string
+	for {
+		yamlContent := struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}{}
+		err := yamlDecoder.Decode(&yamlContent)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			slog.Error("Failed to decode yaml", "err", err)
+			return nil, err
+		}
+
+		if yamlContent.Kind == "" {
+			continue
+		}
+
+		if yamlContent.Metadata.Namespace == "" {
+			namespaces = append(namespaces, "default")
+		} else {
+			namespaces = append(namespaces, yamlContent.Metadata.Namespace)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// splitYaml returns the non-empty documents of a multi-document yamlString.
+func splitYaml(yamlString string) ([]string, error) {
+	yamlDecoder := yaml.NewDecoder(strings.NewReader(yamlString))
+
+	var documents []string
+	for {
+		yamlContent := make(map[string]interface{})
+		err := yamlDecoder.Decode(&yamlContent)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			slog.Error("Failed to decode yaml", "err", err)
+			return nil, err
+		}
+
+		if len(yamlContent) == 0 {
+			continue
+		}
+
+		document, err := yaml.Marshal(yamlContent)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, string(document))
+	}
+
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("yaml has no objects")
+	}
+
+	return documents, nil
+}
+
+// getYamlObjects returns "Kind/namespace/name" for every document in yamlString.
+func getYamlObjects(yamlString string) ([]string, error) {
+	yamlDecoder := yaml.NewDecoder(strings.NewReader(yamlString))
+
+	var objects []string
+	for {
+		yamlContent := struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name      string `yaml:"name"`
+				Namespace string `yaml:"namespace"`
+			} `yaml:"metadata"`
+		}{}
+		err := yamlDecoder.Decode(&yamlContent)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return objects, err
+		}
+
+		if yamlContent.Kind == "" {
+			continue
+		}
+
+		namespace := yamlContent.Metadata.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		objects = append(objects, fmt.Sprintf("%s/%s/%s", yamlContent.Kind, namespace, yamlContent.Metadata.Name))
+	}
+
+	return objects, nil
+}
+
 func yamlToJson(yamlString string) ([]byte, error) {
 	yamlDecoder := yaml.NewDecoder(strings.NewReader(yamlString))
 	yamlContent := make(map[string]interface{})
 	err := yamlDecoder.Decode(&yamlContent)
 	if err != nil {
-		slog.Error("Failed to decode yaml: %v" + err.Error())
+		slog.Error("Failed to decode yaml", "err", err)
 		return nil, err
 	}
 
 	jsonFile, err := json.Marshal(yamlContent)
 	if err != nil {
-		slog.Error("Failed to marshal yaml: %v" + err.Error())
+		slog.Error("Failed to marshal yaml", "err", err)
 		return nil, err
 	}
 
 	return jsonFile, nil
 }
 
-func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
+// ApplyYaml creates or updates every object in yamlString in order, and
+// stops at the first one that fails.
+func (k *KubeController) ApplyYaml(ctx context.Context, yamlString string) (*string, error) {
+	return eachYamlDocument(yamlString, func(document string) (*string, error) {
+		return k.applyObject(ctx, document)
+	})
+}
+
+// DeleteYaml deletes every object in yamlString in order, and stops at the
+// first one that fails.
+func (k *KubeController) DeleteYaml(ctx context.Context, yamlString string) (*string, error) {
+	return eachYamlDocument(yamlString, func(document string) (*string, error) {
+		return k.deleteObject(ctx, document)
+	})
+}
+
+// eachYamlDocument runs fn on every document and joins the messages one per
+// line. An error names the object that failed.
+func eachYamlDocument(yamlString string, fn func(document string) (*string, error)) (*string, error) {
+	documents, err := splitYaml(yamlString)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, document := range documents {
+		message, err := fn(document)
+		if err != nil {
+			if objects, _ := getYamlObjects(document); len(objects) > 0 {
+				return nil, fmt.Errorf("%s: %w", objects[0], err)
+			}
+			return nil, err
+		}
+		messages = append(messages, *message)
+	}
+
+	result := strings.Join(messages, "\n")
+	return &result, nil
+}
+
+func (k *KubeController) applyObject(ctx context.Context, yamlString string) (*string, error) {
 	kind, err := getYamlKind(yamlString)
 	if err != nil {
-		slog.Error("Failed to get yaml kind: %v" + err.Error())
+		slog.Error("Failed to get yaml kind", "err", err)
 		return nil, err
 	}
 
 	jsonFile, err := yamlToJson(yamlString)
 	if err != nil {
-		slog.Error("Failed to convert yaml to json: %v" + err.Error())
+		slog.Error("Failed to convert yaml to json", "err", err)
 		return nil, err
 	}
 
@@ -195,7 +455,7 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 		obj := &appv1.Deployment{}
 		_, _, err := decode.Decode(jsonFile, nil, obj)
 		if err != nil {
-			slog.Error("Failed to decode yaml: %v" + err.Error())
+			slog.Error("Failed to decode yaml", "err", err)
 			return nil, err
 		}
 
@@ -203,12 +463,12 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 			obj.Namespace = "default"
 		}
 
-		_, err = k.Clientset.AppsV1().Deployments(obj.Namespace).Get(context.TODO(), obj.Name, metav1.GetOptions{})
+		_, err = k.Clientset.AppsV1().Deployments(obj.Namespace).Get(ctx, obj.Name, metav1.GetOptions{})
 		if err != nil {
 			if errors.IsNotFound(err) {
-				_, err = k.Clientset.AppsV1().Deployments(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+				_, err = k.Clientset.AppsV1().Deployments(obj.Namespace).Create(ctx, obj, metav1.CreateOptions{})
 				if err != nil {
-					slog.Error("Failed to create deployment: %v" + err.Error())
+					slog.Error("Failed to create deployment", "err", err)
 					return nil, err
 				}
 				createResult := fmt.Sprintf("Successfully deployment applied %s %s", *kind, obj.Name)
@@ -217,9 +477,9 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 			return nil, err
 		}
 
-		_, err = k.Clientset.AppsV1().Deployments(obj.Namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+		_, err = k.Clientset.AppsV1().Deployments(obj.Namespace).Update(ctx, obj, metav1.UpdateOptions{})
 		if err != nil {
-			slog.Error("Failed to update deployment: %v" + err.Error())
+			slog.Error("Failed to update deployment", "err", err)
 			return nil, err
 		}
 		updateResult := fmt.Sprintf("Successfully deployment updated %s %s", *kind, obj.Name)
@@ -230,7 +490,7 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 		obj := &corev1.Service{}
 		_, _, err := decode.Decode(jsonFile, nil, obj)
 		if err != nil {
-			slog.Error("Failed to decode yaml: %v" + err.Error())
+			slog.Error("Failed to decode yaml", "err", err)
 			return nil, err
 		}
 
@@ -238,12 +498,12 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 			obj.Namespace = "default"
 		}
 
-		_, err = k.Clientset.CoreV1().Services(obj.Namespace).Get(context.TODO(), obj.Name, metav1.GetOptions{})
+		_, err = k.Clientset.CoreV1().Services(obj.Namespace).Get(ctx, obj.Name, metav1.GetOptions{})
 		if err != nil {
 			if errors.IsNotFound(err) {
-				_, err = k.Clientset.CoreV1().Services(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+				_, err = k.Clientset.CoreV1().Services(obj.Namespace).Create(ctx, obj, metav1.CreateOptions{})
 				if err != nil {
-					slog.Error("Failed to create service: %v" + err.Error())
+					slog.Error("Failed to create service", "err", err)
 					return nil, err
 				}
 				createResult := fmt.Sprintf("Successfully service applied %s %s", *kind, obj.Name)
@@ -252,9 +512,9 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 			return nil, err
 		}
 
-		_, err = k.Clientset.CoreV1().Services(obj.Namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+		_, err = k.Clientset.CoreV1().Services(obj.Namespace).Update(ctx, obj, metav1.UpdateOptions{})
 		if err != nil {
-			slog.Error("Failed to update service: %v" + err.Error())
+			slog.Error("Failed to update service", "err", err)
 			return nil, err
 		}
 		updateResult := fmt.Sprintf("Successfully service applied %s %s", *kind, obj.Name)
@@ -265,7 +525,7 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 		obj := &corev1.Pod{}
 		_, _, err := decode.Decode(jsonFile, nil, obj)
 		if err != nil {
-			slog.Error("Failed to decode yaml: %v" + err.Error())
+			slog.Error("Failed to decode yaml", "err", err)
 			return nil, err
 		}
 
@@ -273,12 +533,12 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 			obj.Namespace = "default"
 		}
 
-		_, err = k.Clientset.CoreV1().Pods(obj.Namespace).Get(context.TODO(), obj.Name, metav1.GetOptions{})
+		_, err = k.Clientset.CoreV1().Pods(obj.Namespace).Get(ctx, obj.Name, metav1.GetOptions{})
 		if err != nil {
 			if errors.IsNotFound(err) {
-				_, err = k.Clientset.CoreV1().Pods(obj.Namespace).Create(context.TODO(), obj, metav1.CreateOptions{})
+				_, err = k.Clientset.CoreV1().Pods(obj.Namespace).Create(ctx, obj, metav1.CreateOptions{})
 				if err != nil {
-					slog.Error("Failed to create pod: %v" + err.Error())
+					slog.Error("Failed to create pod", "err", err)
 					return nil, err
 				}
 				createResult := fmt.Sprintf("Successfully pod applied %s %s", *kind, obj.Name)
@@ -287,28 +547,28 @@ func (k *KubeController) ApplyYaml(yamlString string) (*string, error) {
 			return nil, err
 		}
 
-		_, err = k.Clientset.CoreV1().Pods(obj.Namespace).Update(context.TODO(), obj, metav1.UpdateOptions{})
+		_, err = k.Clientset.CoreV1().Pods(obj.Namespace).Update(ctx, obj, metav1.UpdateOptions{})
 		if err != nil {
-			slog.Error("Failed to update pod: %v" + err.Error())
+			slog.Error("Failed to update pod", "err", err)
 			return nil, err
 		}
 		updateResult := fmt.Sprintf("Successfully pod applied %s %s", *kind, obj.Name)
 		return &updateResult, nil
 	}
 
-	return nil, err
+	return nil, fmt.Errorf("unsupported kind %s", *kind)
 }
 
-func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
+func (k *KubeController) deleteObject(ctx context.Context, yamlString string) (*string, error) {
 	kind, err := getYamlKind(yamlString)
 	if err != nil {
-		slog.Error("Failed to get yaml kind: %v" + err.Error())
+		slog.Error("Failed to get yaml kind", "err", err)
 		return nil, err
 	}
 
 	jsonFile, err := yamlToJson(yamlString)
 	if err != nil {
-		slog.Error("Failed to convert yaml to json: %v" + err.Error())
+		slog.Error("Failed to convert yaml to json", "err", err)
 		return nil, err
 	}
 
@@ -318,7 +578,7 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 		obj := &appv1.Deployment{}
 		_, _, err := decode.Decode(jsonFile, nil, obj)
 		if err != nil {
-			slog.Error("Failed to decode yaml: %v" + err.Error())
+			slog.Error("Failed to decode yaml", "err", err)
 			return nil, err
 		}
 
@@ -326,9 +586,9 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 			obj.Namespace = "default"
 		}
 
-		err = k.Clientset.AppsV1().Deployments(obj.Namespace).Delete(context.TODO(), obj.Name, metav1.DeleteOptions{})
+		err = k.Clientset.AppsV1().Deployments(obj.Namespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
 		if err != nil {
-			slog.Error("Failed to delete deployment: %v" + err.Error())
+			slog.Error("Failed to delete deployment", "err", err)
 			return nil, err
 		}
 
@@ -340,7 +600,7 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 		obj := &corev1.Service{}
 		_, _, err := decode.Decode(jsonFile, nil, obj)
 		if err != nil {
-			slog.Error("Failed to decode yaml: %v" + err.Error())
+			slog.Error("Failed to decode yaml", "err", err)
 			return nil, err
 		}
 
@@ -348,9 +608,9 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 			obj.Namespace = "default"
 		}
 
-		err = k.Clientset.CoreV1().Services(obj.Namespace).Delete(context.TODO(), obj.Name, metav1.DeleteOptions{})
+		err = k.Clientset.CoreV1().Services(obj.Namespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
 		if err != nil {
-			slog.Error("Failed to delete service: %v" + err.Error())
+			slog.Error("Failed to delete service", "err", err)
 			return nil, err
 		}
 
@@ -363,7 +623,7 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 		obj := &corev1.Pod{}
 		_, _, err := decode.Decode(jsonFile, nil, obj)
 		if err != nil {
-			slog.Error("Failed to decode yaml: %v" + err.Error())
+			slog.Error("Failed to decode yaml", "err", err)
 			return nil, err
 		}
 
@@ -371,9 +631,9 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 			obj.Namespace = "default"
 		}
 
-		err = k.Clientset.CoreV1().Pods(obj.Namespace).Delete(context.TODO(), obj.Name, metav1.DeleteOptions{})
+		err = k.Clientset.CoreV1().Pods(obj.Namespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
 		if err != nil {
-			slog.Error("Failed to delete pod: %v" + err.Error())
+			slog.Error("Failed to delete pod", "err", err)
 			return nil, err
 		}
 
@@ -382,5 +642,5 @@ func (k *KubeController) DeleteYaml(yamlString string) (*string, error) {
 		return &result, nil
 	}
 
-	return nil, err
+	return nil, fmt.Errorf("unsupported kind %s", *kind)
 }
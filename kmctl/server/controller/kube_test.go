@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const testDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: navigation
+  namespace: robot
+spec:
+  selector:
+    matchLabels:
+      app: navigation
+  template:
+    metadata:
+      labels:
+        app: navigation
+    spec:
+      containers:
+        - name: navigation
+          image: registry.local/navigation:24.12.3
+`
+
+func TestGetYamlNamespaces(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want []string
+	}{
+		{testDeployment, []string{"robot"}},
+		{"kind: Service\nmetadata:\n  name: s\n", []string{"default"}},
+		{testDeployment + "---\n---\nkind: Service\nmetadata:\n  name: s\n  namespace: kube-system\n", []string{"robot", "kube-system"}},
+	}
+
+	for _, tt := range tests {
+		got, err := getYamlNamespaces(tt.yaml)
+		if err != nil {
+			t.Fatalf("getYamlNamespaces: %v", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("getYamlNamespaces = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestGetYamlObjects(t *testing.T) {
+	yaml := testDeployment + "---\nkind: Service\nmetadata:\n  name: navigation\n"
+
+	got, err := getYamlObjects(yaml)
+	if err != nil {
+		t.Fatalf("getYamlObjects: %v", err)
+	}
+
+	want := []string{"Deployment/robot/navigation", "Service/default/navigation"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("getYamlObjects = %v, want %v", got, want)
+	}
+}
+
+func TestApplyAndDeleteYaml(t *testing.T) {
+	ctx := context.Background()
+	kubeCon := NewFakeKubeController("sim-01")
+
+	message, err := kubeCon.ApplyYaml(ctx, testDeployment)
+	if err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	if !strings.Contains(*message, "applied") {
+		t.Errorf("first apply message = %q, want a create", *message)
+	}
+
+	message, err = kubeCon.ApplyYaml(ctx, strings.Replace(testDeployment, "24.12.3", "24.12.4", 1))
+	if err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	if !strings.Contains(*message, "updated") {
+		t.Errorf("second apply message = %q, want an update", *message)
+	}
+
+	deployment, err := kubeCon.Clientset.AppsV1().Deployments("robot").Get(ctx, "navigation", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get deployment: %v", err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != "registry.local/navigation:24.12.4" {
+		t.Errorf("image = %s, want the updated image", image)
+	}
+
+	if _, err := kubeCon.DeleteYaml(ctx, testDeployment); err != nil {
+		t.Fatalf("DeleteYaml: %v", err)
+	}
+	_, err = kubeCon.Clientset.AppsV1().Deployments("robot").Get(ctx, "navigation", metav1.GetOptions{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("deployment still exists after delete: %v", err)
+	}
+}
+
+func TestApplyYamlUnsupportedKind(t *testing.T) {
+	kubeCon := NewFakeKubeController("sim-01")
+
+	_, err := kubeCon.ApplyYaml(context.Background(), "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: j\n")
+	if err == nil {
+		t.Fatal("ApplyYaml accepted an unsupported kind")
+	}
+}
+
+func TestApplyYamlDocuments(t *testing.T) {
+	ctx := context.Background()
+	kubeCon := NewFakeKubeController("sim-01")
+
+	yaml := testDeployment + "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: navigation\n  namespace: robot\n---\n"
+	message, err := kubeCon.ApplyYaml(ctx, yaml)
+	if err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	if lines := strings.Split(*message, "\n"); len(lines) != 2 {
+		t.Errorf("apply message = %q, want one line per object", *message)
+	}
+	if _, err := kubeCon.Clientset.CoreV1().Services("robot").Get(ctx, "navigation", metav1.GetOptions{}); err != nil {
+		t.Errorf("second document not applied: %v", err)
+	}
+
+	_, err = kubeCon.ApplyYaml(ctx, yaml+"apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: j\n")
+	if err == nil || !strings.Contains(err.Error(), "Job/default/j") {
+		t.Errorf("ApplyYaml error = %v, want it to name the failed object", err)
+	}
+
+	if _, err := kubeCon.DeleteYaml(ctx, yaml); err != nil {
+		t.Fatalf("DeleteYaml: %v", err)
+	}
+	if _, err := kubeCon.Clientset.CoreV1().Services("robot").Get(ctx, "navigation", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("service still exists after delete: %v", err)
+	}
+}
+
+func TestFakeKubeController(t *testing.T) {
+	ctx := context.Background()
+	kubeCon := NewFakeKubeController("sim-01", &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "navigation-0", Namespace: "robot"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "navigation", Image: "navigation"}}},
+	})
+
+	if err := kubeCon.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+
+	namespace := "robot"
+	pods, err := kubeCon.GetPods(ctx, &namespace)
+	if err != nil {
+		t.Fatalf("GetPods: %v", err)
+	}
+	if len(pods.Items) != 1 {
+		t.Errorf("GetPods returned %d pods, want 1", len(pods.Items))
+	}
+
+	logs, err := kubeCon.GetPodLogs(ctx, "robot", "navigation-0")
+	if err != nil {
+		t.Fatalf("GetPodLogs: %v", err)
+	}
+	if *logs == "" {
+		t.Error("GetPodLogs returned no logs")
+	}
+
+	kubeCon.Close()
+}
+
+// writeKubeconfig writes a kubeconfig to path whose contexts each point to a
+// cluster at https://<context>:6443. The first context is the current one.
+func writeKubeconfig(t *testing.T, path string, contexts ...string) string {
+	t.Helper()
+
+	var clusters, entries strings.Builder
+	for _, name := range contexts {
+		fmt.Fprintf(&clusters, "- name: %s\n  cluster:\n    server: https://%s:6443\n", name, name)
+		fmt.Fprintf(&entries, "- name: %s\n  context: {cluster: %s, user: admin}\n", name, name)
+	}
+	kubeconfig := fmt.Sprintf("apiVersion: v1\nkind: Config\nclusters:\n%susers:\n- name: admin\n  user:\n    token: secret\ncontexts:\n%scurrent-context: %s\n",
+		clusters.String(), entries.String(), contexts[0])
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(kubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// isolateKubeconfig clears the environment GetKubeConfig falls back to and
+// points the home kubeconfig at home, or at a missing file when it is empty.
+func isolateKubeconfig(t *testing.T, home string) {
+	t.Helper()
+
+	t.Setenv(clientcmd.RecommendedConfigPathEnvVar, "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if home == "" {
+		home = filepath.Join(t.TempDir(), "missing")
+	}
+	recommended := clientcmd.RecommendedHomeFile
+	clientcmd.RecommendedHomeFile = home
+	t.Cleanup(func() { clientcmd.RecommendedHomeFile = recommended })
+}
+
+func TestGetKubeConfig(t *testing.T) {
+	dir := t.TempDir()
+	explicit := writeKubeconfig(t, filepath.Join(dir, "explicit"), "explicit-01", "explicit-02")
+	first := writeKubeconfig(t, filepath.Join(dir, "first"), "first-01")
+	second := writeKubeconfig(t, filepath.Join(dir, "second"), "second-01")
+	home := writeKubeconfig(t, filepath.Join(dir, "home", ".kube", "config"), "home-01")
+	merged := first + string(filepath.ListSeparator) + second
+
+	tests := []struct {
+		name        string
+		kubeconfig  string
+		env         string
+		inCluster   bool
+		home        string
+		kubeContext string
+		want        string
+		wantErr     string
+	}{
+		{name: "explicit", kubeconfig: explicit, env: merged, home: home, want: "explicit-01"},
+		{name: "explicit context", kubeconfig: explicit, kubeContext: "explicit-02", want: "explicit-02"},
+		{name: "explicit missing context", kubeconfig: explicit, kubeContext: "explicit-03", wantErr: "explicit-03"},
+		{name: "explicit missing file", kubeconfig: filepath.Join(dir, "missing"), env: merged, wantErr: "missing"},
+		{name: "merged KUBECONFIG", env: merged, inCluster: true, home: home, want: "first-01"},
+		{name: "merged KUBECONFIG context", env: merged, kubeContext: "second-01", want: "second-01"},
+		{name: "merged KUBECONFIG missing context", env: merged, kubeContext: "home-01", home: home, wantErr: "home-01"},
+		{name: "in-cluster before home", inCluster: true, home: home, wantErr: "failed to load in-cluster config"},
+		{name: "in-cluster context", inCluster: true, kubeContext: "home-01", home: home, wantErr: "requires a kubeconfig"},
+		{name: "home", home: home, want: "home-01"},
+		{name: "home missing context", home: home, kubeContext: "explicit-01", wantErr: "explicit-01"},
+		{name: "nothing", wantErr: "failed to load kubeconfig"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateKubeconfig(t, tt.home)
+			t.Setenv(clientcmd.RecommendedConfigPathEnvVar, tt.env)
+			if tt.inCluster {
+				// no service account token is mounted, so the in-cluster
+				// config fails to load when it is picked
+				t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+				t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+			}
+
+			config, name, err := GetKubeConfig(tt.kubeconfig, tt.kubeContext)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetKubeConfig error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetKubeConfig: %v", err)
+			}
+			if name != tt.want {
+				t.Errorf("context = %s, want %s", name, tt.want)
+			}
+			if host := "https://" + tt.want + ":6443"; config.Host != host {
+				t.Errorf("host = %s, want %s", config.Host, host)
+			}
+		})
+	}
+}
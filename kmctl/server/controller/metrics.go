@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+
+	pb "com.kubebackend/m/proto"
+)
+
+const metricsNamespace = "kube_backend"
+
+var (
+	// GRPCMetrics holds the per-method request counts, latencies and codes.
+	GRPCMetrics = grpcprom.NewServerMetrics(
+		grpcprom.WithServerHandlingTimeHistogram(),
+	)
+
+	operationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "operations_total",
+		Help:      "Apply, delete and upgrade operations by cluster, component and result.",
+	}, []string{"operation", "cluster", "component", "result"})
+
+	logStreamsActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "log_streams_active",
+		Help:      "Number of pod log streams currently open.",
+	})
+
+	kubeRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "kube_request_duration_seconds",
+		Help:      "Latency of requests to the Kubernetes API server.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"verb", "host"})
+
+	kubeRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "kube_requests_total",
+		Help:      "Requests to the Kubernetes API server by status code.",
+	}, []string{"code", "method", "host"})
+
+	informerSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "informer_synced",
+		Help:      "Whether the informer cache of a resource has synced (1) or not (0).",
+	}, []string{"cluster", "resource"})
+
+	informerObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "informer_objects",
+		Help:      "Number of objects in the informer cache of a resource.",
+	}, []string{"cluster", "resource"})
+
+	podsByPhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "pods",
+		Help:      "Number of pods in the cluster by namespace and phase.",
+	}, []string{"cluster", "namespace", "phase"})
+
+	nodesReady = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_ready",
+		Help:      "Whether the node's Ready condition is true (1) or not (0).",
+	}, []string{"cluster", "node"})
+)
+
+// NewMetricsRegistry returns a registry with the process, gRPC, Kubernetes
+// client and kube-backend metrics. Kubernetes client metrics can only be
+// hooked up once per process.
+func NewMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		GRPCMetrics,
+		operationsTotal,
+		logStreamsActive,
+		kubeRequestDuration,
+		kubeRequestsTotal,
+		informerSynced,
+		informerObjects,
+		podsByPhase,
+		nodesReady,
+	)
+
+	clientmetrics.Register(clientmetrics.RegisterOpts{
+		RequestLatency: kubeLatencyMetric{},
+		RequestResult:  kubeResultMetric{},
+	})
+
+	return registry
+}
+
+// OperationsInterceptor counts apply, delete, upgrade and rollback calls.
+// Upgrades and rollbacks are labelled with the upgrade component, apply and
+// delete with the kind of the first object in the manifest, which keeps the
+// label values bounded.
+func (s *server) OperationsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !mutatingMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		resp, err := handler(ctx, req)
+
+		operation := strings.ToLower(strings.TrimSuffix(path.Base(info.FullMethod), "Yaml"))
+		if info.FullMethod == pb.KubeBackend_RollbackUpgrade_FullMethodName {
+			operation = "rollback"
+		}
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		cluster := ""
+		if r, ok := req.(clusterRequest); ok {
+			cluster = r.GetCluster()
+		}
+		if cluster == "" {
+			cluster = s.defaultCluster
+		} else if _, ok := s.clusters[cluster]; !ok {
+			cluster = "unknown"
+		}
+		operationsTotal.WithLabelValues(operation, cluster, s.operationComponent(req), result).Inc()
+
+		return resp, err
+	}
+}
+
+// upgradeRequest is implemented by the requests of upgrades and rollbacks.
+type upgradeRequest interface {
+	GetType() int32
+}
+
+func (s *server) operationComponent(req interface{}) string {
+	if r, ok := req.(upgradeRequest); ok {
+		if component, err := s.component(r.GetType()); err == nil {
+			return component.Name
+		}
+		return "unknown"
+	}
+
+	if r, ok := req.(yamlRequest); ok {
+		objects, _ := getYamlObjects(r.GetYaml())
+		if len(objects) > 0 {
+			kind, _, _ := strings.Cut(objects[0], "/")
+			return kind
+		}
+	}
+
+	return "unknown"
+}
+
+type kubeLatencyMetric struct{}
+
+func (kubeLatencyMetric) Observe(ctx context.Context, verb string, u url.URL, latency time.Duration) {
+	kubeRequestDuration.WithLabelValues(verb, u.Host).Observe(latency.Seconds())
+}
+
+type kubeResultMetric struct{}
+
+func (kubeResultMetric) Increment(ctx context.Context, code string, method string, host string) {
+	kubeRequestsTotal.WithLabelValues(code, method, host).Inc()
+}
+
+// WatchInformers runs node and pod informers and keeps the cache metrics of
+// the cluster up to date until ctx is cancelled.
+func (k *KubeController) WatchInformers(ctx context.Context, resync time.Duration) {
+	factory := informers.NewSharedInformerFactory(k.Clientset, resync)
+	nodeInformer := factory.Core().V1().Nodes()
+	podInformer := factory.Core().V1().Pods()
+
+	// register the informers before starting the factory
+	nodeSynced := nodeInformer.Informer().HasSynced
+	podSynced := podInformer.Informer().HasSynced
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	// the series of the previous update, to delete those that are gone
+	// instead of resetting the gauges while they are scraped
+	nodeSeries := map[string]bool{}
+	podSeries := map[[2]string]bool{}
+	update := func() {
+		informerSynced.WithLabelValues(k.name, "nodes").Set(boolGauge(nodeSynced()))
+		informerSynced.WithLabelValues(k.name, "pods").Set(boolGauge(podSynced()))
+
+		nodeList, _ := nodeInformer.Lister().List(labels.Everything())
+		informerObjects.WithLabelValues(k.name, "nodes").Set(float64(len(nodeList)))
+		nodes := map[string]bool{}
+		for _, node := range nodeList {
+			ready := false
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == corev1.NodeReady {
+					ready = condition.Status == corev1.ConditionTrue
+				}
+			}
+			nodesReady.WithLabelValues(k.name, node.Name).Set(boolGauge(ready))
+			nodes[node.Name] = true
+		}
+		for name := range nodeSeries {
+			if !nodes[name] {
+				nodesReady.DeleteLabelValues(k.name, name)
+			}
+		}
+		nodeSeries = nodes
+
+		pods, _ := podInformer.Lister().List(labels.Everything())
+		informerObjects.WithLabelValues(k.name, "pods").Set(float64(len(pods)))
+		phases := map[[2]string]int{}
+		for _, pod := range pods {
+			phases[[2]string{pod.Namespace, string(pod.Status.Phase)}]++
+		}
+		for series, count := range phases {
+			podsByPhase.WithLabelValues(k.name, series[0], series[1]).Set(float64(count))
+		}
+		for series := range podSeries {
+			if _, ok := phases[series]; !ok {
+				podsByPhase.DeleteLabelValues(k.name, series[0], series[1])
+			}
+		}
+		podSeries = map[[2]string]bool{}
+		for series := range phases {
+			podSeries[series] = true
+		}
+	}
+
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	update()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			update()
+		}
+	}
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+
+	pb "com.kubebackend/m/proto"
+)
+
+func TestOperationsInterceptor(t *testing.T) {
+	s, _ := newUpgradeServer(t)
+	interceptor := s.OperationsInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	requests := []struct {
+		method string
+		req    interface{}
+	}{
+		{pb.KubeBackend_ApplyYaml_FullMethodName, &pb.ApplyYamlRequest{Yaml: testNavigationService}},
+		{pb.KubeBackend_DeleteYaml_FullMethodName, &pb.ApplyYamlRequest{Yaml: testNavigationService, Cluster: "robot-99"}},
+		{pb.KubeBackend_UpgradeYaml_FullMethodName, &pb.UpgradeYamlRequest{Type: 0}},
+		{pb.KubeBackend_RollbackUpgrade_FullMethodName, &pb.RollbackUpgradeRequest{Type: 7}},
+	}
+	for _, r := range requests {
+		if _, err := interceptor(context.Background(), r.req, &grpc.UnaryServerInfo{FullMethod: r.method}, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, labels := range [][]string{
+		{"apply", "sim-01", "Service", "success"},
+		{"delete", "unknown", "Service", "success"},
+		{"upgrade", "sim-01", "NAVIGATION", "success"},
+		{"rollback", "sim-01", "unknown", "success"},
+	} {
+		if got := testutil.ToFloat64(operationsTotal.WithLabelValues(labels...)); got != 1 {
+			t.Errorf("operations_total%v = %v, want 1", labels, got)
+		}
+	}
+	if got := testutil.ToFloat64(operationsTotal.WithLabelValues("apply", "sim-01", "navigation", "success")); got != 0 {
+		t.Errorf("apply is labelled with the object name")
+	}
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ApplySetLabel marks the objects applied with --prune. Its value identifies
+// the apply set by its name and the selector it was applied with.
+const ApplySetLabel = "kube-backend/apply-set"
+
+// PrunableKinds are the kinds ApplyYaml can prune, and DefaultPruneKinds
+// those pruned when the request names none.
+var (
+	PrunableKinds     = []string{"Deployment", "Service", "Pod"}
+	DefaultPruneKinds = []string{"Deployment", "Service"}
+)
+
+type applySet struct {
+	id string
+	// selector is the request's selector plus the apply set label
+	selector labels.Selector
+	kinds    []string
+}
+
+// newApplySet returns the apply set name, by default the source of the
+// manifest, selected with selectorString. Two manifests pruned with the same
+// selector do not prune each other's objects unless they share the name.
+func newApplySet(name, selectorString string, kinds []string) (*applySet, error) {
+	if strings.TrimSpace(selectorString) == "" {
+		return nil, fmt.Errorf("prune needs a selector")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("prune needs an apply set name or the source of the manifest")
+	}
+
+	selector, err := labels.Parse(selectorString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+
+	if len(kinds) == 0 {
+		kinds = DefaultPruneKinds
+	}
+	for _, kind := range kinds {
+		if !slices.Contains(PrunableKinds, kind) {
+			return nil, fmt.Errorf("kind %s can not be pruned, want one of %s", kind, strings.Join(PrunableKinds, ", "))
+		}
+	}
+
+	sum := sha256.Sum256([]byte(name + "\n" + selector.String()))
+	id := hex.EncodeToString(sum[:8])
+
+	requirement, err := labels.NewRequirement(ApplySetLabel, selection.Equals, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	return &applySet{
+		id:       id,
+		selector: selector.Add(*requirement),
+		kinds:    kinds,
+	}, nil
+}
+
+// label adds the apply set label to every object in yamlString. Every object
+// must match the selector, so that the next apply with it can prune them.
+func (a *applySet) label(yamlString string) (string, error) {
+	yamlDecoder := yaml.NewDecoder(strings.NewReader(yamlString))
+
+	var documents []string
+	for {
+		yamlContent := make(map[string]interface{})
+		err := yamlDecoder.Decode(&yamlContent)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if len(yamlContent) == 0 {
+			continue
+		}
+
+		metadata, _ := yamlContent["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+			yamlContent["metadata"] = metadata
+		}
+		objectLabels, _ := metadata["labels"].(map[string]interface{})
+		if objectLabels == nil {
+			objectLabels = map[string]interface{}{}
+			metadata["labels"] = objectLabels
+		}
+		objectLabels[ApplySetLabel] = a.id
+
+		set := labels.Set{}
+		for key, value := range objectLabels {
+			set[key] = fmt.Sprint(value)
+		}
+		if !a.selector.Matches(set) {
+			return "", fmt.Errorf("%s/%v does not match the prune selector", yamlContent["kind"], metadata["name"])
+		}
+
+		document, err := yaml.Marshal(yamlContent)
+		if err != nil {
+			return "", err
+		}
+		documents = append(documents, string(document))
+	}
+
+	return strings.Join(documents, "---\n"), nil
+}
+
+// prune deletes the objects of the apply set that yamlString no longer has,
+// in the namespaces of yamlString and those stored for the apply set.
+func (a *applySet) prune(ctx context.Context, backend Backend, yamlString string, stored []string, dryRun bool) ([]string, error) {
+	keep, err := getYamlObjects(yamlString)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces, err := getYamlNamespaces(yamlString)
+	if err != nil {
+		return nil, err
+	}
+	namespaces = append(namespaces, stored...)
+	slices.Sort(namespaces)
+	namespaces = slices.Compact(namespaces)
+
+	return backend.PruneObjects(ctx, a.kinds, namespaces, a.selector.String(), keep, dryRun)
+}
+
+// PruneObjects deletes the objects of kinds in namespaces that match
+// selector, except keep ("Kind/namespace/name"). With dryRun it only returns
+// them.
+func (k *KubeController) PruneObjects(ctx context.Context, kinds, namespaces []string, selector string, keep []string, dryRun bool) ([]string, error) {
+	listOptions := metav1.ListOptions{LabelSelector: selector}
+
+	var pruned []string
+	for _, namespace := range namespaces {
+		for _, kind := range kinds {
+			var names []string
+			var remove func(name string) error
+
+			switch kind {
+			case "Deployment":
+				deployments, err := k.Clientset.AppsV1().Deployments(namespace).List(ctx, listOptions)
+				if err != nil {
+					return pruned, err
+				}
+				for _, deployment := range deployments.Items {
+					names = append(names, deployment.Name)
+				}
+				remove = func(name string) error {
+					return k.Clientset.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+				}
+			case "Service":
+				services, err := k.Clientset.CoreV1().Services(namespace).List(ctx, listOptions)
+				if err != nil {
+					return pruned, err
+				}
+				for _, service := range services.Items {
+					names = append(names, service.Name)
+				}
+				remove = func(name string) error {
+					return k.Clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+				}
+			case "Pod":
+				pods, err := k.Clientset.CoreV1().Pods(namespace).List(ctx, listOptions)
+				if err != nil {
+					return pruned, err
+				}
+				for _, pod := range pods.Items {
+					names = append(names, pod.Name)
+				}
+				remove = func(name string) error {
+					return k.Clientset.CoreV1().Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+				}
+			default:
+				return pruned, fmt.Errorf("unsupported kind %s", kind)
+			}
+
+			for _, name := range names {
+				object := fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+				if slices.Contains(keep, object) {
+					continue
+				}
+				if !dryRun {
+					if err := remove(name); err != nil {
+						return pruned, fmt.Errorf("%s: %w", object, err)
+					}
+				}
+				pruned = append(pruned, object)
+			}
+		}
+	}
+
+	return pruned, nil
+}
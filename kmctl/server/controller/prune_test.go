@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	appv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
+)
+
+const testStackSelector = "app.kubernetes.io/part-of=robot-stack"
+
+func testStackDeployment(name string) string {
+	return strings.NewReplacer("name: navigation", "name: "+name, "namespace: robot", "namespace: robot\n  labels:\n    app.kubernetes.io/part-of: robot-stack").Replace(testDeployment)
+}
+
+func TestApplyYamlPrune(t *testing.T) {
+	ctx := context.Background()
+	// not applied with the selector, so never pruned
+	unmanaged := &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+		Name:      "unmanaged",
+		Namespace: "robot",
+		Labels:    map[string]string{"app.kubernetes.io/part-of": "robot-stack"},
+	}}
+	backend := NewFakeKubeController("sim-01", unmanaged)
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	full := testStackDeployment("navigation") + "---\n" + testStackDeployment("diagnostics")
+	response, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: full, Prune: true, Selector: testStackSelector, Source: "stack.yaml"})
+	if err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	if len(response.Pruned) != 0 {
+		t.Errorf("first apply pruned %v", response.Pruned)
+	}
+
+	deployment, err := backend.Clientset.AppsV1().Deployments("robot").Get(ctx, "diagnostics", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Labels[ApplySetLabel] == "" {
+		t.Errorf("labels = %v, want the apply set label", deployment.Labels)
+	}
+
+	reduced := testStackDeployment("navigation")
+	response, err = s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: reduced, Prune: true, Selector: testStackSelector, Source: "stack.yaml", DryRun: true})
+	if err != nil {
+		t.Fatalf("ApplyYaml dry run: %v", err)
+	}
+	want := []string{"Deployment/robot/diagnostics"}
+	if !reflect.DeepEqual(response.Pruned, want) {
+		t.Errorf("dry run pruned = %v, want %v", response.Pruned, want)
+	}
+	if _, err := backend.Clientset.AppsV1().Deployments("robot").Get(ctx, "diagnostics", metav1.GetOptions{}); err != nil {
+		t.Errorf("dry run deleted the deployment: %v", err)
+	}
+
+	response, err = s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: reduced, Prune: true, Selector: testStackSelector, Source: "stack.yaml"})
+	if err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	if !reflect.DeepEqual(response.Pruned, want) {
+		t.Errorf("pruned = %v, want %v", response.Pruned, want)
+	}
+	if _, err := backend.Clientset.AppsV1().Deployments("robot").Get(ctx, "diagnostics", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("diagnostics was not pruned: %v", err)
+	}
+	for _, name := range []string{"navigation", "unmanaged"} {
+		if _, err := backend.Clientset.AppsV1().Deployments("robot").Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Errorf("%s was pruned: %v", name, err)
+		}
+	}
+}
+
+func TestApplyYamlPruneInvalid(t *testing.T) {
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{NewFakeKubeController("sim-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request *pb.ApplyYamlRequest
+		want    string
+	}{
+		{"no selector", &pb.ApplyYamlRequest{Yaml: testDeployment, Prune: true}, "needs a selector"},
+		{"no apply set", &pb.ApplyYamlRequest{Yaml: testStackDeployment("navigation"), Prune: true, Selector: testStackSelector}, "needs an apply set name"},
+		{"not selected", &pb.ApplyYamlRequest{Yaml: testDeployment, Prune: true, Selector: testStackSelector, Source: "stack.yaml"}, "Deployment/navigation does not match"},
+		{"kind", &pb.ApplyYamlRequest{Yaml: testStackDeployment("navigation"), Prune: true, Selector: testStackSelector, Source: "stack.yaml", PruneKinds: []string{"Secret"}}, "kind Secret can not be pruned"},
+		{"dry run without prune", &pb.ApplyYamlRequest{Yaml: testDeployment, DryRun: true}, "only previews a prune"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ApplyYaml(context.Background(), tt.request)
+			if status.Code(err) != codes.InvalidArgument || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ApplyYaml error = %v, want InvalidArgument %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyYamlPruneApplySets(t *testing.T) {
+	ctx := context.Background()
+	backend := NewFakeKubeController("sim-01")
+	s, err := NewServerWithBackends(&model.Config{Database: filepath.Join(t.TempDir(), "test.db")}, []Backend{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apply := func(yaml, source, applySet string) []string {
+		t.Helper()
+		response, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Yaml: yaml, Prune: true, Selector: testStackSelector, Source: source, ApplySet: applySet})
+		if err != nil {
+			t.Fatalf("ApplyYaml %s: %v", source, err)
+		}
+		return response.Pruned
+	}
+	tools := strings.Replace(testStackDeployment("diagnostics"), "namespace: robot", "namespace: tools", 1)
+
+	apply(testStackDeployment("navigation")+"---\n"+tools, "stack.yaml", "")
+	// another manifest with the same selector is another apply set
+	if pruned := apply(testStackDeployment("monitoring"), "monitoring.yaml", ""); len(pruned) != 0 {
+		t.Errorf("monitoring.yaml pruned %v of stack.yaml", pruned)
+	}
+
+	// the tools namespace is gone from the manifest, but not from the apply set
+	want := []string{"Deployment/tools/diagnostics"}
+	if pruned := apply(testStackDeployment("navigation"), "stack.yaml", ""); !reflect.DeepEqual(pruned, want) {
+		t.Errorf("pruned = %v, want %v", pruned, want)
+	}
+
+	// a moved manifest keeps its apply set by name
+	apply(testStackDeployment("monitoring"), "monitoring.yaml", "monitoring")
+	want = []string{"Deployment/robot/monitoring"}
+	if pruned := apply(testStackDeployment("planner"), "moved/monitoring.yaml", "monitoring"); !reflect.DeepEqual(pruned, want) {
+		t.Errorf("pruned = %v, want %v", pruned, want)
+	}
+}
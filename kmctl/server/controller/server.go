@@ -2,24 +2,82 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	"com.kubebackend/m/client/controller"
 	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
 )
 
 type server struct {
-	kubeCon *KubeController
+	// clusters are keyed by kubeconfig context, clusterNames keeps their order
+	clusters       map[string]Backend
+	clusterNames   []string
+	defaultCluster string
+	db             *controller.DBController
+	namespaces     []string
+	components     []model.Component
+	shutdownCtx    context.Context
+	closeStreams   context.CancelFunc
 	pb.UnimplementedKubeBackendServer
 }
 
+// cluster returns the controller for a request's cluster field. An empty
+// name selects the default cluster.
+func (s *server) cluster(name string) (Backend, error) {
+	if name == "" {
+		name = s.defaultCluster
+	}
+
+	kubeCon, ok := s.clusters[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "unknown cluster %q", name)
+	}
+
+	return kubeCon, nil
+}
+
+// Ping succeeds while at least one cluster is reachable, so that one
+// stopped simulator does not take the whole server out of service.
+func (s *server) Ping(ctx context.Context) error {
+	var errs []error
+	for _, name := range s.clusterNames {
+		if err := s.clusters[name].Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	if len(errs) == len(s.clusterNames) {
+		return errors.Join(errs...)
+	}
+	for _, err := range errs {
+		slog.Warn("Cluster is not reachable", "err", err)
+	}
+
+	return nil
+}
+
 func (s *server) GetNodes(ctx context.Context, in *pb.GetNodesRequest) (*pb.NodeList, error) {
-	nodes, err := s.kubeCon.GetNodes()
+	kubeCon, err := s.cluster(in.Cluster)
 	if err != nil {
-		log.Printf("Failed to get nodes: %v", err)
+		slog.Error("Failed to get nodes", "err", err)
+		return nil, err
+	}
+
+	nodes, err := kubeCon.GetNodes(ctx)
+	if err != nil {
+		slog.Error("Failed to get nodes", "err", err)
 		return nil, err
 	}
 
@@ -33,15 +91,21 @@ func (s *server) GetNodes(ctx context.Context, in *pb.GetNodesRequest) (*pb.Node
 		})
 	}
 
-	log.Printf("GetNodesResponse: all")
+	log.Printf("GetNodesResponse: %s", kubeCon.Name())
 
 	return &nodeList, nil
 }
 
 func (s *server) GetNode(ctx context.Context, in *pb.GetNodeRequest) (*pb.Node, error) {
-	node, err := s.kubeCon.GetNode(in.Name)
+	kubeCon, err := s.cluster(in.Cluster)
 	if err != nil {
-		log.Printf("Failed to get node: %v", err)
+		slog.Error("Failed to get node", "err", err)
+		return nil, err
+	}
+
+	node, err := kubeCon.GetNode(ctx, in.Name)
+	if err != nil {
+		slog.Error("Failed to get node", "err", err)
 		return nil, err
 	}
 
@@ -56,10 +120,21 @@ func (s *server) GetNode(ctx context.Context, in *pb.GetNodeRequest) (*pb.Node,
 }
 
 func (s *server) GetPods(ctx context.Context, in *pb.GetPodsRequest) (*pb.PodList, error) {
-	log.Printf("GetPodsRequest: %v", in)
-	pods, err := s.kubeCon.GetPods(&in.Namespace)
+	slog.Debug("GetPodsRequest", "request", in)
+	if err := s.checkNamespace(ctx, in.Namespace); err != nil {
+		slog.Error("Failed to get pods", "err", err)
+		return nil, err
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to get pods", "err", err)
+		return nil, err
+	}
+
+	pods, err := kubeCon.GetPods(ctx, &in.Namespace)
 	if err != nil {
-		log.Printf("Failed to get pods: %v", err)
+		slog.Error("Failed to get pods", "err", err)
 		return nil, err
 	}
 
@@ -80,9 +155,20 @@ func (s *server) GetPods(ctx context.Context, in *pb.GetPodsRequest) (*pb.PodLis
 }
 
 func (s *server) GetPod(ctx context.Context, in *pb.GetPodRequest) (*pb.Pod, error) {
-	pod, err := s.kubeCon.GetPod(in.Namespace, in.Name)
+	if err := s.checkNamespace(ctx, in.Namespace); err != nil {
+		slog.Error("Failed to get pod", "err", err)
+		return nil, err
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
 	if err != nil {
-		log.Printf("Failed to get pod: %v", err)
+		slog.Error("Failed to get pod", "err", err)
+		return nil, err
+	}
+
+	pod, err := kubeCon.GetPod(ctx, in.Namespace, in.Name)
+	if err != nil {
+		slog.Error("Failed to get pod", "err", err)
 		return nil, err
 	}
 
@@ -98,16 +184,33 @@ func (s *server) GetPod(ctx context.Context, in *pb.GetPodRequest) (*pb.Pod, err
 }
 
 func (s *server) GetPodLogs(in *pb.GetPodLogsRequest, stream pb.KubeBackend_GetPodLogsServer) error {
-	logs, err := s.kubeCon.GetPodLogs(in.Namespace, in.Name)
+	if err := s.checkNamespace(stream.Context(), in.Namespace); err != nil {
+		slog.Error("Failed to get pod logs", "err", err)
+		return err
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
 	if err != nil {
-		log.Printf("Failed to get pod logs: %v", err)
+		slog.Error("Failed to get pod logs", "err", err)
 		return err
 	}
 
+	logStreamsActive.Inc()
+	defer logStreamsActive.Dec()
+
+	ctx, cancel := s.streamContext(stream.Context())
+	defer cancel()
+
+	logs, err := kubeCon.GetPodLogs(ctx, in.Namespace, in.Name)
+	if err != nil {
+		slog.Error("Failed to get pod logs", "err", err)
+		return streamError(ctx, err)
+	}
+
 	if err := stream.Send(&pb.GetPodLogsResponse{
 		Log: *logs,
 	}); err != nil {
-		log.Printf("Failed to send logs: %v", err)
+		slog.Error("Failed to send logs", "err", err)
 		return err
 	}
 
@@ -116,68 +219,206 @@ func (s *server) GetPodLogs(in *pb.GetPodLogsRequest, stream pb.KubeBackend_GetP
 	return nil
 }
 
+// checkNamespace rejects namespaces outside the server's configured
+// namespaces and those the caller may not use.
+func (s *server) checkNamespace(ctx context.Context, namespace string) error {
+	if !model.NamespaceAllowed(s.namespaces, namespace) {
+		return status.Errorf(codes.PermissionDenied, "namespace %q is not served by this server", namespace)
+	}
+
+	return CheckNamespace(ctx, namespace)
+}
+
+func (s *server) checkYamlNamespace(ctx context.Context, yamlString string) error {
+	namespaces, err := getYamlNamespaces(yamlString)
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		if err := s.checkNamespace(ctx, namespace); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// component returns the upgrade component for an UpgradeYamlRequest type.
+func (s *server) component(upgradeType int32) (*model.Component, error) {
+	for i := range s.components {
+		if s.components[i].Type == upgradeType {
+			return &s.components[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid upgrade type")
+}
+
 func (s *server) ApplyYaml(ctx context.Context, in *pb.ApplyYamlRequest) (*pb.ApplyYamlResponse, error) {
-	message, err := s.kubeCon.ApplyYaml(in.Yaml)
+	if err := s.checkYamlNamespace(ctx, in.Yaml); err != nil {
+		slog.Error("Failed to apply yaml", "err", err)
+		return nil, err
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
 	if err != nil {
-		log.Printf("Failed to apply yaml: %v", err)
+		slog.Error("Failed to apply yaml", "err", err)
 		return nil, err
 	}
 
-	log.Printf("ApplyYamlResponse: %s", *message)
+	if in.DryRun && !in.Prune {
+		return nil, status.Error(codes.InvalidArgument, "dry run only previews a prune")
+	}
 
-	return &pb.ApplyYamlResponse{
-		Message: *message,
-	}, nil
+	documents, err := splitYaml(in.Yaml)
+	if err != nil {
+		slog.Error("Failed to apply yaml", "err", err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// the documents as applied, with the apply set label when pruning
+	labeled := documents
+	var set *applySet
+	applySet := ""
+	if in.Prune {
+		name := in.ApplySet
+		if name == "" {
+			name = in.Source
+		}
+		set, err = newApplySet(name, in.Selector, in.PruneKinds)
+		if err == nil {
+			applySet = set.id
+			labeled = make([]string, len(documents))
+			for i, document := range documents {
+				if labeled[i], err = set.label(document); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			slog.Error("Failed to apply yaml", "err", err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	response := &pb.ApplyYamlResponse{}
+	if !in.DryRun {
+		// objects are applied one at a time so that those applied before a
+		// failure are still recorded, with the hash of the manifest as sent
+		var messages, applied []string
+		for i, document := range labeled {
+			message, err := kubeCon.ApplyYaml(ctx, document)
+			if err != nil {
+				slog.Error("Failed to apply yaml", "err", err)
+				if len(applied) > 0 {
+					s.recordInventory(ctx, kubeCon.Name(), strings.Join(applied, "---\n"), in.Source, applySet)
+				}
+				return nil, err
+			}
+			messages = append(messages, *message)
+			applied = append(applied, documents[i])
+		}
+
+		response.Message = strings.Join(messages, "\n")
+		log.Printf("ApplyYamlResponse: %s", response.Message)
+		s.recordInventory(ctx, kubeCon.Name(), strings.Join(applied, "---\n"), in.Source, applySet)
+	}
+
+	if set != nil {
+		stored := s.applySetNamespaces(ctx, kubeCon.Name(), set.id)
+		response.Pruned, err = set.prune(ctx, kubeCon, in.Yaml, stored, in.DryRun)
+		if err != nil {
+			slog.Error("Failed to prune", "err", err)
+			return nil, err
+		}
+
+		log.Printf("Pruned (dry run %t): %v", in.DryRun, response.Pruned)
+		if !in.DryRun {
+			s.forgetInventory(kubeCon.Name(), response.Pruned)
+		}
+	}
+
+	return response, nil
 }
 
 func (s *server) DeleteYaml(ctx context.Context, in *pb.ApplyYamlRequest) (*pb.ApplyYamlResponse, error) {
-	message, err := s.kubeCon.DeleteYaml(in.Yaml)
+	if err := s.checkYamlNamespace(ctx, in.Yaml); err != nil {
+		slog.Error("Failed to delete yaml", "err", err)
+		return nil, err
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to delete yaml", "err", err)
+		return nil, err
+	}
+
+	message, err := kubeCon.DeleteYaml(ctx, in.Yaml)
 	if err != nil {
-		log.Printf("Failed to delete yaml: %v", err)
+		slog.Error("Failed to delete yaml", "err", err)
 		return nil, err
 	}
 
 	log.Printf("DeleteYamlResponse: %s", *message)
+	objects, _ := getYamlObjects(in.Yaml)
+	s.forgetInventory(kubeCon.Name(), objects)
 
 	return &pb.ApplyYamlResponse{
 		Message: *message,
 	}, nil
 }
 
+// UpgradeYaml applies a component version and records it. Everything is
+// validated before the cluster is touched; when applying or recording fails
+// the objects are restored to their state before the upgrade.
 func (s *server) UpgradeYaml(ctx context.Context, in *pb.UpgradeYamlRequest) (*pb.UpgradeYamlResponse, error) {
-	message, err := s.kubeCon.ApplyYaml(in.Yaml)
-	if err != nil {
-		log.Printf("Failed to upgrade yaml: %v", err)
+	if err := s.checkYamlNamespace(ctx, in.Yaml); err != nil {
+		slog.Error("Failed to upgrade yaml", "err", err)
 		return nil, err
 	}
 
-	log.Printf("UpgradeYamlResponse: %s", *message)
-	major, minor1, minor2, err := parseVersion(in.Version)
+	kubeCon, err := s.cluster(in.Cluster)
 	if err != nil {
-		log.Println(err)
+		slog.Error("Failed to upgrade yaml", "err", err)
 		return nil, err
 	}
 
-	databasePath := "/database/database.db"
-	dbCon := controller.NewDB(&databasePath)
+	metadata := map[string]string{"version": in.Version, "cluster": kubeCon.Name()}
 
-	repoNames := []string{"MICOM_MANAGER", "DEVICE_BRINGUP", "NAVIGATION", "MIDDLEWARE"}
-	tableNames := []string{"micom_managers", "device_bringups", "navigations", "middlewares"}
+	component, err := s.component(in.Type)
+	if err != nil {
+		slog.Error("Failed to upgrade yaml", "err", err)
+		return nil, upgradeError(codes.InvalidArgument, "INVALID_TYPE", metadata, err)
+	}
+	metadata["component"] = component.Name
+
+	major, minor1, minor2, err := parseVersion(in.Version)
+	if err != nil {
+		slog.Error("Failed to upgrade yaml", "err", err)
+		return nil, upgradeError(codes.InvalidArgument, "INVALID_VERSION", metadata, err)
+	}
 
-	if in.Type < 0 || in.Type >= int32(len(repoNames)) {
-		log.Printf("Invalid upgrade type")
-		return nil, fmt.Errorf("invalid upgrade type")
+	if s.db == nil {
+		slog.Warn("Database is not available")
+		return nil, upgradeError(codes.FailedPrecondition, "DATABASE_UNAVAILABLE", metadata, fmt.Errorf("database is not available"))
 	}
 
-	log.Printf("Upgrade %s Ver %d.%d.%d\n", repoNames[in.Type], major, minor1, minor2)
+	log.Printf("Upgrade %s Ver %d.%d.%d\n", component.Name, major, minor1, minor2)
 	repo := controller.Repo{
-		Repo_name:   repoNames[in.Type],
+		Repo_name:   component.Name,
 		Ver_major:   major,
 		Ver_minor_1: minor1,
 		Ver_minor_2: minor2,
-		Updated_at:  "CURRENT_TIMESTAMP",
+		Action:      "upgrade",
+		Manifest:    in.Yaml,
+	}
+	message, err := s.changeComponent(ctx, kubeCon, component, &repo, in.Yaml, in.Source, metadata, func(ctx context.Context) (*string, error) {
+		return kubeCon.ApplyYaml(ctx, in.Yaml)
+	})
+	if err != nil {
+		return nil, err
 	}
-	dbCon.InsertRepo(&tableNames[in.Type], &repo)
 
 	log.Printf("UpgradeYamlResponse: %s", *message)
 
@@ -186,6 +427,120 @@ func (s *server) UpgradeYaml(ctx context.Context, in *pb.UpgradeYamlRequest) (*p
 	}, nil
 }
 
+func (s *server) GetAuditLog(ctx context.Context, in *pb.GetAuditLogRequest) (*pb.AuditLog, error) {
+	if s.db == nil {
+		slog.Warn("Database is not available")
+		return nil, fmt.Errorf("database is not available")
+	}
+
+	filter := controller.AuditFilter{
+		Caller:  in.Caller,
+		Method:  in.Method,
+		Cluster: in.Cluster,
+		Limit:   int(in.Limit),
+	}
+	if filter.Cluster == "" {
+		filter.Cluster = s.defaultCluster
+	}
+	if in.Since != nil {
+		filter.Since = in.Since.AsTime()
+	}
+	if in.Until != nil {
+		filter.Until = in.Until.AsTime()
+	}
+	// callers limited to some namespaces get the limit applied after filtering
+	restricted := CheckNamespace(ctx, "") != nil
+	if restricted {
+		filter.Limit = 0
+	}
+
+	var audits []controller.Audit
+	if err := s.db.GetAudits(&filter, &audits); err != nil {
+		slog.Error("Failed to get audit log", "err", err)
+		return nil, err
+	}
+
+	var auditLog pb.AuditLog
+	for _, audit := range audits {
+		if restricted && !s.auditVisible(ctx, &audit) {
+			continue
+		}
+		if in.Limit > 0 && len(auditLog.Entries) == int(in.Limit) {
+			break
+		}
+
+		entry := &pb.AuditEntry{
+			Time:        timestamppb.New(audit.Created_at),
+			Caller:      audit.Caller,
+			Peer:        audit.Peer_addr,
+			Method:      audit.Method,
+			RequestHash: audit.Request_hash,
+			Result:      audit.Result,
+			Error:       audit.Error,
+			DurationMs:  audit.Duration_ms,
+			Cluster:     audit.Cluster,
+		}
+		if audit.Objects != "" {
+			entry.Objects = strings.Split(audit.Objects, ",")
+		}
+		auditLog.Entries = append(auditLog.Entries, entry)
+	}
+
+	log.Printf("GetAuditLogResponse: %d entries", len(auditLog.Entries))
+
+	return &auditLog, nil
+}
+
+// auditVisible reports whether a caller limited to some namespaces may see
+// audit: all its objects must be in namespaces the caller may use, and records
+// without objects are only shown to their own caller.
+func (s *server) auditVisible(ctx context.Context, audit *controller.Audit) bool {
+	if audit.Objects == "" {
+		identity, ok := IdentityFromContext(ctx)
+		return ok && identity.Name == audit.Caller
+	}
+
+	for _, object := range strings.Split(audit.Objects, ",") {
+		if _, namespace, _ := splitObject(object); s.checkNamespace(ctx, namespace) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *server) ListClusters(ctx context.Context, in *pb.ListClustersRequest) (*pb.ClusterList, error) {
+	var clusterList pb.ClusterList
+	var wg sync.WaitGroup
+	for _, name := range s.clusterNames {
+		kubeCon := s.clusters[name]
+		info := &pb.ClusterInfo{
+			Name:    name,
+			Server:  kubeCon.Host(),
+			Default: name == s.defaultCluster,
+			Ready:   true,
+		}
+		clusterList.Clusters = append(clusterList.Clusters, info)
+
+		// ping concurrently so that hung clusters do not add up
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+			defer cancel()
+			if err := kubeCon.Ping(pingCtx); err != nil {
+				info.Ready = false
+				info.Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	log.Printf("ListClustersResponse: %d clusters", len(clusterList.Clusters))
+
+	return &clusterList, nil
+}
+
 func parseVersion(version string) (int, int, int, error) {
 	versions := strings.Split(version, ".")
 	if len(versions) != 3 {
@@ -210,13 +565,117 @@ func parseVersion(version string) (int, int, int, error) {
 	return major, minor1, minor2, nil
 }
 
-func NewServer(kubeconfig string) *server {
-	kubeCon, err := NewKubeController(&kubeconfig)
+func formatVersion(major, minor1, minor2 int) string {
+	return fmt.Sprintf("%d.%d.%d", major, minor1, minor2)
+}
+
+// NewServer creates a KubeController for every configured kubeconfig
+// context, or for the current context when none is configured.
+func NewServer(config *model.Config) (*server, error) {
+	contexts := config.Contexts
+	if slices.Contains(contexts, "*") {
+		all, err := GetKubeContexts(config.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		contexts = all
+	}
+	if len(contexts) == 0 {
+		contexts = []string{config.Context}
+	}
+
+	var backends []Backend
+	for _, kubeContext := range contexts {
+		kubeCon, err := NewKubeController(config.Kubeconfig, kubeContext)
+		if err != nil {
+			return nil, err
+		}
+		backends = append(backends, kubeCon)
+	}
+
+	return NewServerWithBackends(config, backends)
+}
+
+// NewServerWithBackends serves the given backends under their names. The
+// default cluster is config.Context when it is one of them, else the first.
+func NewServerWithBackends(config *model.Config, backends []Backend) (*server, error) {
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no clusters to serve")
+	}
+
+	s := &server{
+		clusters:   make(map[string]Backend),
+		namespaces: config.Namespaces,
+		components: config.Components,
+	}
+
+	for _, backend := range backends {
+		if _, ok := s.clusters[backend.Name()]; ok {
+			continue
+		}
+		s.clusters[backend.Name()] = backend
+		s.clusterNames = append(s.clusterNames, backend.Name())
+	}
+
+	s.defaultCluster = s.clusterNames[0]
+	if _, ok := s.clusters[config.Context]; ok {
+		s.defaultCluster = config.Context
+	}
+
+	db, err := controller.OpenDB(&config.Database)
 	if err != nil {
-		log.Fatalf("Failed to create kube controller: %v", err)
+		slog.Error("Failed to open database, audit log and upgrade records are disabled", "database", config.Database, "err", err)
+	}
+	if db != nil {
+		var tables []string
+		for _, component := range config.Components {
+			tables = append(tables, component.Table)
+		}
+		if err := db.MigrateRepoTables(tables); err != nil {
+			slog.Error("Failed to create component tables", "err", err)
+		}
 	}
+	s.db = db
+
+	s.shutdownCtx, s.closeStreams = context.WithCancel(context.Background())
+
+	return s, nil
+}
+
+// DB returns the server database, or nil when it could not be opened.
+func (s *server) DB() *controller.DBController {
+	return s.db
+}
+
+func (s *server) ClusterNames() []string {
+	return s.clusterNames
+}
+
+// Clusters returns the cluster controllers in configuration order.
+func (s *server) Clusters() []Backend {
+	var clusters []Backend
+	for _, name := range s.clusterNames {
+		clusters = append(clusters, s.clusters[name])
+	}
+	return clusters
+}
+
+func (s *server) DefaultCluster() string {
+	return s.defaultCluster
+}
 
-	return &server{
-		kubeCon: kubeCon,
+// WaitReady waits for every cluster's API server concurrently and logs the
+// ones that stay unreachable.
+func (s *server) WaitReady(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, kubeCon := range s.Clusters() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := kubeCon.WaitReady(ctx); err != nil {
+				slog.Warn("Kubernetes API is not reachable, starting anyway", "cluster", kubeCon.Name(), "err", err)
+			}
+		}()
 	}
+	wg.Wait()
 }
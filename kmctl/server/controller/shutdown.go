@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errShuttingDown = errors.New("server shutting down")
+
+// streamContext derives the context of a server stream. It is cancelled when
+// the client goes away or when CloseStreams is called during shutdown.
+func (s *server) streamContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	stop := context.AfterFunc(s.shutdownCtx, func() {
+		cancel(errShuttingDown)
+	})
+
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// streamError turns err into an Unavailable status when the stream was ended
+// by a shutdown, so clients can tell it apart from a failed request.
+func streamError(ctx context.Context, err error) error {
+	if errors.Is(context.Cause(ctx), errShuttingDown) {
+		return status.Error(codes.Unavailable, errShuttingDown.Error())
+	}
+	return err
+}
+
+// CloseStreams ends every open log and watch stream with an Unavailable
+// "server shutting down" status.
+func (s *server) CloseStreams() {
+	s.closeStreams()
+}
+
+// Close releases the database and the Kubernetes client connections. It must
+// be called after the gRPC server has stopped.
+func (s *server) Close() {
+	s.closeStreams()
+
+	if s.db != nil {
+		s.db.Close()
+	}
+
+	for _, kubeCon := range s.clusters {
+		kubeCon.Close()
+	}
+}
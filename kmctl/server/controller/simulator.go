@@ -0,0 +1,700 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	"com.kubebackend/m/server/model"
+)
+
+// PinnedAnnotation set to "true" on a fixture object keeps the simulator
+// from changing its status, e.g. to demo a robot that stays broken.
+const PinnedAnnotation = "simulate.kube-backend/pinned"
+
+const simulatedLogLines = 200
+
+var simulatedLogMessages = []string{
+	"heartbeat ok",
+	"published robot status",
+	"localization converged",
+	"waiting for mission",
+	"battery at %d%%",
+}
+
+// Simulator is a fake cluster that moves pods through their phases, reports
+// node conditions and rolls deployments out one pod per tick.
+type Simulator struct {
+	*KubeController
+	tick        time.Duration
+	failureRate float64
+	rand        *rand.Rand
+}
+
+var _ Backend = (*Simulator)(nil)
+
+// NewSimulator returns a simulated cluster holding objects. failureRate is
+// the chance per tick that a node turns NotReady or a container crashes.
+func NewSimulator(name string, tick time.Duration, failureRate float64, objects ...runtime.Object) *Simulator {
+	seed := fnv.New64a()
+	seed.Write([]byte(name))
+
+	return &Simulator{
+		KubeController: NewFakeKubeController(name, objects...),
+		tick:           tick,
+		failureRate:    failureRate,
+		rand:           rand.New(rand.NewPCG(seed.Sum64(), 0)),
+	}
+}
+
+// NewSimulators builds the simulated clusters of config: robot-01 up to
+// config.Robots plus one per fixtures subdirectory. YAML files directly in
+// the fixtures directory seed every cluster, those in a subdirectory only
+// the cluster of that name. Clusters without nodes get one.
+func NewSimulators(config *model.Fake) ([]*Simulator, error) {
+	names, shared, own, err := loadFixtures(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var simulators []*Simulator
+	for i, name := range names {
+		var objects []runtime.Object
+		for _, obj := range shared {
+			objects = append(objects, obj.DeepCopyObject())
+		}
+		objects = append(objects, own[name]...)
+
+		hasNode := slices.ContainsFunc(objects, func(obj runtime.Object) bool {
+			_, ok := obj.(*corev1.Node)
+			return ok
+		})
+		if !hasNode {
+			objects = append(objects, simulatedNode(name, i))
+		}
+
+		simulators = append(simulators, NewSimulator(name, config.Tick, config.FailureRate, objects...))
+	}
+
+	return simulators, nil
+}
+
+// ValidateFixtures reads and decodes the fixtures of config and checks that
+// they give at least one cluster, without building the simulators.
+func ValidateFixtures(config *model.Fake) error {
+	_, _, _, err := loadFixtures(config)
+	return err
+}
+
+// loadFixtures returns the names of the simulated clusters of config, the
+// objects seeding every cluster and those seeding a single one.
+func loadFixtures(config *model.Fake) ([]string, []runtime.Object, map[string][]runtime.Object, error) {
+	var names []string
+	for i := 1; i <= config.Robots; i++ {
+		names = append(names, fmt.Sprintf("robot-%02d", i))
+	}
+
+	var shared []runtime.Object
+	own := map[string][]runtime.Object{}
+	if config.Fixtures != "" {
+		entries, err := os.ReadDir(config.Fixtures)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to read fixtures: %v", err)
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(config.Fixtures, entry.Name())
+			if !entry.IsDir() {
+				objects, err := loadFixture(path)
+				if err != nil {
+					return nil, nil, nil, err
+				}
+				shared = append(shared, objects...)
+				continue
+			}
+
+			objects, err := loadFixtureDir(path)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			own[entry.Name()] = objects
+			if !slices.Contains(names, entry.Name()) {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil, nil, fmt.Errorf("no simulated clusters, set fake.robots or add fixture subdirectories")
+	}
+
+	return names, shared, own, nil
+}
+
+// NewFakeServer serves the simulated clusters of config.Fake.
+func NewFakeServer(config *model.Config) (*server, error) {
+	simulators, err := NewSimulators(&config.Fake)
+	if err != nil {
+		return nil, err
+	}
+
+	var backends []Backend
+	for _, simulator := range simulators {
+		backends = append(backends, simulator)
+	}
+
+	return NewServerWithBackends(config, backends)
+}
+
+func loadFixtureDir(dir string) ([]runtime.Object, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %v", err)
+	}
+
+	var objects []runtime.Object
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		fileObjects, err := loadFixture(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, fileObjects...)
+	}
+
+	return objects, nil
+}
+
+// loadFixture decodes every document of a YAML file. Other files are
+// ignored.
+func loadFixture(path string) ([]runtime.Object, error) {
+	if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %v", err)
+	}
+
+	var objects []runtime.Object
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixture %s: %v", path, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode fixture %s: %v", path, err)
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+func simulatedNode(name string, index int) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				"kubernetes.io/arch":     "arm64",
+				"kubernetes.io/os":       "linux",
+				"kubernetes.io/hostname": name,
+			},
+			Annotations: map[string]string{
+				"k3s.io/internal-ip": fmt.Sprintf("10.42.%d.%d", index/250, index%250+1),
+			},
+		},
+		Status: corev1.NodeStatus{
+			NodeInfo: corev1.NodeSystemInfo{
+				Architecture:            "arm64",
+				OperatingSystem:         "linux",
+				KubeletVersion:          "v1.31.4+k3s1",
+				ContainerRuntimeVersion: "containerd://1.7.23-k3s2",
+			},
+		},
+	}
+}
+
+// Run advances the simulation every tick until ctx is done.
+func (s *Simulator) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.tick)
+	defer ticker.Stop()
+
+	for {
+		if err := s.step(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Simulation failed", "cluster", s.Name(), "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Simulator) step(ctx context.Context) error {
+	nodeName, err := s.stepNodes(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.stepPods(ctx, nodeName); err != nil {
+		return err
+	}
+	return s.stepDeployments(ctx, nodeName)
+}
+
+func (s *Simulator) failed() bool {
+	return s.failureRate > 0 && s.rand.Float64() < s.failureRate
+}
+
+func pinned(meta *metav1.ObjectMeta) bool {
+	return meta.Annotations[PinnedAnnotation] == "true"
+}
+
+// stepNodes reports every node Ready unless it fails this tick, and returns
+// the node pods are scheduled to.
+func (s *Simulator) stepNodes(ctx context.Context) (string, error) {
+	nodes, err := s.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	var nodeName string
+	now := metav1.Now()
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if nodeName == "" {
+			nodeName = node.Name
+		}
+		if pinned(&node.ObjectMeta) {
+			continue
+		}
+
+		ready := corev1.NodeCondition{
+			Type:    corev1.NodeReady,
+			Status:  corev1.ConditionTrue,
+			Reason:  "KubeletReady",
+			Message: "kubelet is posting ready status",
+		}
+		if s.failed() {
+			ready.Status = corev1.ConditionFalse
+			ready.Reason = "KubeletNotReady"
+			ready.Message = "simulated network outage"
+		}
+
+		conditions := []corev1.NodeCondition{
+			{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse, Reason: "KubeletHasSufficientMemory"},
+			{Type: corev1.NodeDiskPressure, Status: corev1.ConditionFalse, Reason: "KubeletHasNoDiskPressure"},
+			{Type: corev1.NodePIDPressure, Status: corev1.ConditionFalse, Reason: "KubeletHasSufficientPID"},
+			ready,
+		}
+		for j := range conditions {
+			conditions[j].LastHeartbeatTime = now
+			conditions[j].LastTransitionTime = now
+			for _, old := range node.Status.Conditions {
+				if old.Type == conditions[j].Type && old.Status == conditions[j].Status {
+					conditions[j].LastTransitionTime = old.LastTransitionTime
+				}
+			}
+		}
+		node.Status.Conditions = conditions
+
+		if _, err := s.Clientset.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{}); err != nil {
+			return "", err
+		}
+	}
+
+	return nodeName, nil
+}
+
+// stepPods moves new pods to Pending, Pending pods to Running, restarts
+// crashed containers and crashes running ones at the failure rate.
+func (s *Simulator) stepPods(ctx context.Context, nodeName string) error {
+	pods, err := s.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pinned(&pod.ObjectMeta) || !s.advancePod(pod, nodeName) {
+			continue
+		}
+		if _, err := s.Clientset.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, pod, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// advancePod moves pod one step further and reports whether it changed.
+func (s *Simulator) advancePod(pod *corev1.Pod, nodeName string) bool {
+	now := metav1.Now()
+
+	switch pod.Status.Phase {
+	case "":
+		if pod.Spec.NodeName == "" {
+			pod.Spec.NodeName = nodeName
+		}
+		setPodPending(pod)
+		return true
+
+	case corev1.PodPending:
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.StartTime = &now
+		pod.Status.PodIP = fmt.Sprintf("10.244.0.%d", s.rand.IntN(250)+2)
+		pod.Status.ContainerStatuses = nil
+		for _, container := range pod.Spec.Containers {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+				Name:    container.Name,
+				Image:   container.Image,
+				Ready:   true,
+				Started: ptr(true),
+				State:   corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: now}},
+			})
+		}
+		setPodReady(pod, true)
+		return true
+
+	case corev1.PodRunning:
+		for i := range pod.Status.ContainerStatuses {
+			status := &pod.Status.ContainerStatuses[i]
+			if status.State.Waiting != nil {
+				status.State = corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: now}}
+				status.Ready = true
+				setPodReady(pod, true)
+				return true
+			}
+		}
+
+		if len(pod.Status.ContainerStatuses) > 0 && s.failed() {
+			status := &pod.Status.ContainerStatuses[s.rand.IntN(len(pod.Status.ContainerStatuses))]
+			status.RestartCount++
+			status.Ready = false
+			status.State = corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason:  "CrashLoopBackOff",
+				Message: "simulated crash",
+			}}
+			setPodReady(pod, false)
+			return true
+		}
+	}
+
+	return false
+}
+
+func setPodPending(pod *corev1.Pod) {
+	pod.Status.Phase = corev1.PodPending
+	pod.Status.Conditions = []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: metav1.Now()},
+	}
+	pod.Status.ContainerStatuses = nil
+	for _, container := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:  container.Name,
+			Image: container.Image,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}},
+		})
+	}
+}
+
+func setPodReady(pod *corev1.Pod, ready bool) {
+	condition := corev1.PodCondition{
+		Type:               corev1.PodReady,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+	}
+	if ready {
+		condition.Status = corev1.ConditionTrue
+	}
+
+	for i := range pod.Status.Conditions {
+		if pod.Status.Conditions[i].Type == corev1.PodReady {
+			pod.Status.Conditions[i] = condition
+			return
+		}
+	}
+	pod.Status.Conditions = append(pod.Status.Conditions, condition)
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return pod.Status.Phase == corev1.PodRunning && condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// stepDeployments acts as the deployment controller: it adds one pod of the
+// current template per tick until there are enough, removes one outdated
+// pod once the new ones are ready, and updates the rollout status.
+func (s *Simulator) stepDeployments(ctx context.Context, nodeName string) error {
+	deployments, err := s.Clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if pinned(&deployment.ObjectMeta) {
+			continue
+		}
+		if err := s.rollout(ctx, deployment, nodeName); err != nil {
+			return fmt.Errorf("deployment %s/%s: %v", deployment.Namespace, deployment.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Simulator) rollout(ctx context.Context, deployment *appv1.Deployment, nodeName string) error {
+	pods := s.Clientset.CoreV1().Pods(deployment.Namespace)
+	list, err := pods.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	hash := templateHash(&deployment.Spec.Template)
+	var current, outdated []corev1.Pod
+	for _, pod := range list.Items {
+		if !ownedBy(&pod, deployment) {
+			continue
+		}
+		if pod.Labels[appv1.DefaultDeploymentUniqueLabelKey] == hash {
+			current = append(current, pod)
+		} else {
+			outdated = append(outdated, pod)
+		}
+	}
+
+	replicas := 1
+	if deployment.Spec.Replicas != nil {
+		replicas = int(*deployment.Spec.Replicas)
+	}
+
+	switch {
+	case len(current) < replicas:
+		pod := s.newDeploymentPod(deployment, hash, nodeName)
+		if _, err := pods.Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+		current = append(current, *pod)
+	case len(current) > replicas:
+		last := current[len(current)-1]
+		if err := pods.Delete(ctx, last.Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		current = current[:len(current)-1]
+	}
+
+	readyCurrent := 0
+	for i := range current {
+		if podReady(&current[i]) {
+			readyCurrent++
+		}
+	}
+
+	if len(outdated) > 0 && readyCurrent+len(outdated) > replicas {
+		if err := pods.Delete(ctx, outdated[0].Name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		outdated = outdated[1:]
+	}
+
+	ready := readyCurrent
+	for i := range outdated {
+		if podReady(&outdated[i]) {
+			ready++
+		}
+	}
+
+	status := appv1.DeploymentStatus{
+		ObservedGeneration:  deployment.Generation,
+		Replicas:            int32(len(current) + len(outdated)),
+		UpdatedReplicas:     int32(len(current)),
+		ReadyReplicas:       int32(ready),
+		AvailableReplicas:   int32(ready),
+		UnavailableReplicas: int32(max(replicas-ready, 0)),
+	}
+
+	available := appv1.DeploymentCondition{
+		Type:    appv1.DeploymentAvailable,
+		Status:  corev1.ConditionTrue,
+		Reason:  "MinimumReplicasAvailable",
+		Message: "Deployment has minimum availability.",
+	}
+	if ready < replicas {
+		available.Status = corev1.ConditionFalse
+		available.Reason = "MinimumReplicasUnavailable"
+		available.Message = "Deployment does not have minimum availability."
+	}
+
+	progressing := appv1.DeploymentCondition{
+		Type:    appv1.DeploymentProgressing,
+		Status:  corev1.ConditionTrue,
+		Reason:  "ReplicaSetUpdated",
+		Message: fmt.Sprintf("Deployment %q is progressing: %d of %d updated replicas are ready.", deployment.Name, readyCurrent, replicas),
+	}
+	if readyCurrent == replicas && len(current) == replicas && len(outdated) == 0 {
+		progressing.Reason = "NewReplicaSetAvailable"
+		progressing.Message = fmt.Sprintf("Deployment %q has successfully progressed.", deployment.Name)
+	}
+
+	status.Conditions = []appv1.DeploymentCondition{available, progressing}
+	now := metav1.Now()
+	for i := range status.Conditions {
+		condition := &status.Conditions[i]
+		condition.LastUpdateTime = now
+		condition.LastTransitionTime = now
+		for _, old := range deployment.Status.Conditions {
+			if old.Type != condition.Type {
+				continue
+			}
+			if old.Status == condition.Status {
+				condition.LastTransitionTime = old.LastTransitionTime
+			}
+			if old.Status == condition.Status && old.Reason == condition.Reason && old.Message == condition.Message {
+				condition.LastUpdateTime = old.LastUpdateTime
+			}
+		}
+	}
+
+	if equality.Semantic.DeepEqual(status, deployment.Status) {
+		return nil
+	}
+
+	deployment.Status = status
+	_, err = s.Clientset.AppsV1().Deployments(deployment.Namespace).UpdateStatus(ctx, deployment, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *Simulator) newDeploymentPod(deployment *appv1.Deployment, hash, nodeName string) *corev1.Pod {
+	template := deployment.Spec.Template.DeepCopy()
+
+	labels := map[string]string{}
+	for key, value := range template.Labels {
+		labels[key] = value
+	}
+	labels[appv1.DefaultDeploymentUniqueLabelKey] = hash
+
+	const letters = "bcdfghjklmnpqrstvwxz2456789"
+	suffix := make([]byte, 5)
+	for i := range suffix {
+		suffix[i] = letters[s.rand.IntN(len(letters))]
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("%s-%s-%s", deployment.Name, hash, suffix),
+			Namespace:   deployment.Namespace,
+			Labels:      labels,
+			Annotations: template.Annotations,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deployment.Name,
+				UID:        deployment.UID,
+				Controller: ptr(true),
+			}},
+		},
+		Spec: template.Spec,
+	}
+	if pod.Spec.NodeName == "" {
+		pod.Spec.NodeName = nodeName
+	}
+	setPodPending(pod)
+
+	return pod
+}
+
+// ownedBy matches by name because the fake clientset does not assign UIDs.
+func ownedBy(pod *corev1.Pod, deployment *appv1.Deployment) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "Deployment" && owner.Name == deployment.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func templateHash(template *corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	hash := fnv.New32a()
+	hash.Write(data)
+	return fmt.Sprintf("%08x", hash.Sum32())[:8]
+}
+
+// GetPodLogs returns a line per tick since the pod started, up to the last
+// 200, and fails like the real API for pods that have not started yet.
+func (s *Simulator) GetPodLogs(ctx context.Context, namespace, name string) (*string, error) {
+	pod, err := s.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	container, image := "", ""
+	if len(pod.Spec.Containers) > 0 {
+		container, image = pod.Spec.Containers[0].Name, pod.Spec.Containers[0].Image
+	}
+	if pod.Status.StartTime == nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("container %q in pod %q is waiting to start: ContainerCreating", container, name))
+	}
+
+	start := pod.Status.StartTime.Time
+	count := int(time.Since(start)/s.tick) + 1
+	first := max(count-simulatedLogLines, 0)
+
+	var builder strings.Builder
+	for i := first; i < count; i++ {
+		message := simulatedLogMessages[i%len(simulatedLogMessages)]
+		switch {
+		case i == 0:
+			message = fmt.Sprintf("starting %s", image)
+		case strings.Contains(message, "%d"):
+			message = fmt.Sprintf(message, 100-i/len(simulatedLogMessages)%80)
+		}
+		fmt.Fprintf(&builder, "%s INFO %s: %s\n", start.Add(time.Duration(i)*s.tick).UTC().Format(time.RFC3339), container, message)
+	}
+
+	logs := builder.String()
+	return &logs, nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"com.kubebackend/m/server/model"
+)
+
+func TestNewSimulators(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "navigation.yaml"), []byte(testDeployment), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "lab-01"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	node := "apiVersion: v1\nkind: Node\nmetadata:\n  name: lab-node\n"
+	if err := os.WriteFile(filepath.Join(dir, "lab-01", "node.yaml"), []byte(node), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	simulators, err := NewSimulators(&model.Fake{Fixtures: dir, Robots: 2, Tick: time.Second})
+	if err != nil {
+		t.Fatalf("NewSimulators: %v", err)
+	}
+
+	var names []string
+	for _, simulator := range simulators {
+		names = append(names, simulator.Name())
+	}
+	if want := []string{"robot-01", "robot-02", "lab-01"}; !slices.Equal(names, want) {
+		t.Errorf("clusters = %v, want %v", names, want)
+	}
+
+	ctx := context.Background()
+	for _, simulator := range simulators {
+		if _, err := simulator.Clientset.AppsV1().Deployments("robot").Get(ctx, "navigation", metav1.GetOptions{}); err != nil {
+			t.Errorf("%s: shared fixture missing: %v", simulator.Name(), err)
+		}
+	}
+
+	if _, err := simulators[0].GetNode(ctx, "robot-01"); err != nil {
+		t.Errorf("robot-01 has no generated node: %v", err)
+	}
+	if _, err := simulators[2].GetNode(ctx, "lab-node"); err != nil {
+		t.Errorf("lab-01 fixture node missing: %v", err)
+	}
+	if _, err := simulators[2].GetNode(ctx, "lab-01"); !errors.IsNotFound(err) {
+		t.Errorf("lab-01 got a generated node besides its fixture node: %v", err)
+	}
+
+	if _, err := NewSimulators(&model.Fake{Tick: time.Second}); err == nil {
+		t.Error("NewSimulators accepted a config without clusters")
+	}
+}
+
+func TestValidateFixtures(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "navigation.yaml"), []byte(testDeployment), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateFixtures(&model.Fake{Fixtures: dir, Tick: time.Second}); err == nil {
+		t.Error("ValidateFixtures accepted fixtures without clusters")
+	}
+	if err := ValidateFixtures(&model.Fake{Fixtures: dir, Robots: 1, Tick: time.Second}); err != nil {
+		t.Errorf("ValidateFixtures: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("kind: Unknown\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err := ValidateFixtures(&model.Fake{Fixtures: dir, Robots: 1, Tick: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "broken.yaml") {
+		t.Errorf("ValidateFixtures error = %v, want it to name the broken fixture", err)
+	}
+}
+
+func deploymentPods(t *testing.T, simulator *Simulator) []corev1.Pod {
+	t.Helper()
+
+	pods, err := simulator.Clientset.CoreV1().Pods("robot").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pods.Items
+}
+
+func TestSimulatorRollout(t *testing.T) {
+	ctx := context.Background()
+	simulator := NewSimulator("robot-01", time.Second, 0, simulatedNode("robot-01", 0))
+
+	if _, err := simulator.ApplyYaml(ctx, testDeployment); err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+
+	steps := func(n int) {
+		for i := 0; i < n; i++ {
+			if err := simulator.step(ctx); err != nil {
+				t.Fatalf("step: %v", err)
+			}
+		}
+	}
+
+	steps(1)
+	pods := deploymentPods(t, simulator)
+	if len(pods) != 1 || pods[0].Status.Phase != corev1.PodPending || pods[0].Spec.NodeName != "robot-01" {
+		t.Fatalf("after one step pods = %+v, want one pending pod on robot-01", pods)
+	}
+	if _, err := simulator.GetPodLogs(ctx, "robot", pods[0].Name); !errors.IsBadRequest(err) {
+		t.Errorf("logs of a pending pod = %v, want BadRequest", err)
+	}
+
+	steps(2)
+	pods = deploymentPods(t, simulator)
+	if len(pods) != 1 || !podReady(&pods[0]) {
+		t.Fatalf("pods = %+v, want one ready pod", pods)
+	}
+	deployment, err := simulator.Clientset.AppsV1().Deployments("robot").Get(ctx, "navigation", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Status.ReadyReplicas != 1 || deployment.Status.UpdatedReplicas != 1 {
+		t.Errorf("status = %+v, want one ready updated replica", deployment.Status)
+	}
+
+	logs, err := simulator.GetPodLogs(ctx, "robot", pods[0].Name)
+	if err != nil {
+		t.Fatalf("GetPodLogs: %v", err)
+	}
+	if !strings.Contains(*logs, "starting registry.local/navigation:24.12.3") {
+		t.Errorf("logs = %q, want the start line", *logs)
+	}
+
+	// a new image rolls out: the new pod starts before the old one goes
+	if _, err := simulator.ApplyYaml(ctx, strings.Replace(testDeployment, "24.12.3", "24.12.4", 1)); err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+	steps(1)
+	if pods := deploymentPods(t, simulator); len(pods) != 2 {
+		t.Fatalf("during rollout %d pods, want 2", len(pods))
+	}
+	steps(2)
+	pods = deploymentPods(t, simulator)
+	if len(pods) != 1 || pods[0].Spec.Containers[0].Image != "registry.local/navigation:24.12.4" || !podReady(&pods[0]) {
+		t.Fatalf("after rollout pods = %+v, want one ready 24.12.4 pod", pods)
+	}
+
+	deployment, err = simulator.Clientset.AppsV1().Deployments("robot").Get(ctx, "navigation", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appv1.DeploymentProgressing && condition.Reason != "NewReplicaSetAvailable" {
+			t.Errorf("progressing = %s, want NewReplicaSetAvailable", condition.Reason)
+		}
+	}
+}
+
+func TestSimulatorNodes(t *testing.T) {
+	ctx := context.Background()
+	pinnedNode := simulatedNode("robot-02", 1)
+	pinnedNode.Annotations[PinnedAnnotation] = "true"
+
+	simulator := NewSimulator("robot-01", time.Second, 1, simulatedNode("robot-01", 0), pinnedNode)
+	if err := simulator.step(ctx); err != nil {
+		t.Fatalf("step: %v", err)
+	}
+
+	node, err := simulator.GetNode(ctx, "robot-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status != corev1.ConditionFalse {
+			t.Errorf("node ready = %s with a failure rate of 1, want False", condition.Status)
+		}
+	}
+
+	node, err = simulator.GetNode(ctx, "robot-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Status.Conditions) != 0 {
+		t.Errorf("pinned node got conditions %+v", node.Status.Conditions)
+	}
+}
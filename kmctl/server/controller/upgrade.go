@@ -0,0 +1,534 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"gopkg.in/yaml.v3"
+
+	"com.kubebackend/m/client/controller"
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
+)
+
+// UpgradeErrorDomain is the ErrorInfo domain of failed upgrades. The reason
+// names the step that failed, and the metadata says whether the cluster was
+// restored.
+const UpgradeErrorDomain = "kube-backend/upgrade"
+
+// restoreTimeout bounds restoring a snapshot, which runs even when the
+// request has been cancelled.
+const restoreTimeout = 30 * time.Second
+
+// snapshotAPIVersions are the API versions of the kinds an upgrade can
+// snapshot.
+var snapshotAPIVersions = map[string]string{
+	"Deployment": "apps/v1",
+	"Service":    "v1",
+	"Pod":        "v1",
+}
+
+// objectSnapshot is the live state of one object before an upgrade. Manifest
+// is empty when the object did not exist.
+type objectSnapshot struct {
+	Object   string `json:"object"`
+	Manifest string `json:"manifest,omitempty"`
+}
+
+// snapshotObjects saves the live state of every object in yamlString.
+func snapshotObjects(ctx context.Context, backend Backend, yamlString string) ([]objectSnapshot, error) {
+	objects, err := getYamlObjects(yamlString)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []objectSnapshot
+	for _, object := range objects {
+		kind, namespace, name := splitObject(object)
+		apiVersion, ok := snapshotAPIVersions[kind]
+		if !ok {
+			return nil, fmt.Errorf("%s: unsupported kind %s", object, kind)
+		}
+
+		live, err := backend.GetObjects(ctx, kind, namespace, name, "")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", object, err)
+		}
+		if len(live) == 0 {
+			snapshots = append(snapshots, objectSnapshot{Object: object})
+			continue
+		}
+
+		// keep what applying the object back needs, not the server state
+		content := live[0]
+		content["apiVersion"] = apiVersion
+		content["kind"] = kind
+		delete(content, "status")
+		if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+			for _, field := range []string{"resourceVersion", "uid", "creationTimestamp", "generation", "managedFields"} {
+				delete(metadata, field)
+			}
+		}
+
+		manifest, err := yaml.Marshal(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", object, err)
+		}
+		snapshots = append(snapshots, objectSnapshot{Object: object, Manifest: string(manifest)})
+	}
+
+	return snapshots, nil
+}
+
+// restoreSnapshot puts every object back to its snapshot in reverse order,
+// deleting those that did not exist. It restores as many objects as it can.
+func restoreSnapshot(ctx context.Context, backend Backend, snapshots []objectSnapshot) error {
+	var errs []error
+	for _, snapshot := range slices.Backward(snapshots) {
+		if snapshot.Manifest != "" {
+			if _, err := backend.ApplyYaml(ctx, snapshot.Manifest); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		kind, namespace, name := splitObject(snapshot.Object)
+		manifest := fmt.Sprintf("apiVersion: %s\nkind: %s\nmetadata:\n  name: %s\n  namespace: %s\n", snapshotAPIVersions[kind], kind, name, namespace)
+		objects, err := backend.GetObjects(ctx, kind, namespace, name, "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", snapshot.Object, err))
+			continue
+		}
+		if len(objects) == 0 {
+			continue
+		}
+		if _, err := backend.DeleteYaml(ctx, manifest); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// upgradeError returns a status with an ErrorInfo for reason and metadata.
+func upgradeError(code codes.Code, reason string, metadata map[string]string, err error) error {
+	st, detailErr := status.New(code, err.Error()).WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   UpgradeErrorDomain,
+		Metadata: metadata,
+	})
+	if detailErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
+
+// abortUpgrade restores snapshots after step failed with err, and returns
+// the error saying whether the cluster is back to its state before the
+// upgrade.
+func abortUpgrade(ctx context.Context, backend Backend, snapshots []objectSnapshot, reason string, metadata map[string]string, err error) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), restoreTimeout)
+	defer cancel()
+
+	restoreErr := restoreSnapshot(ctx, backend, snapshots)
+	metadata["restored"] = strconv.FormatBool(restoreErr == nil)
+	if restoreErr != nil {
+		metadata["restoreError"] = restoreErr.Error()
+		return upgradeError(codes.Internal, reason, metadata, fmt.Errorf("%w; restoring the cluster failed: %v", err, restoreErr))
+	}
+
+	return upgradeError(codes.Aborted, reason, metadata, fmt.Errorf("%w; the cluster was restored", err))
+}
+
+// changeComponent makes change to the cluster and records repo as the new
+// version of component, with the live state of objects before the change.
+// When change or recording fails, the objects are restored.
+func (s *server) changeComponent(ctx context.Context, kubeCon Backend, component *model.Component, repo *controller.Repo, objects, source string, metadata map[string]string, change func(context.Context) (*string, error)) (*string, error) {
+	snapshots, err := snapshotObjects(ctx, kubeCon, objects)
+	if err != nil {
+		slog.Error("Failed to snapshot objects", "err", err)
+		return nil, upgradeError(codes.FailedPrecondition, "SNAPSHOT_FAILED", metadata, err)
+	}
+	previous, err := json.Marshal(snapshots)
+	if err != nil {
+		slog.Error("Failed to snapshot objects", "err", err)
+		return nil, upgradeError(codes.FailedPrecondition, "SNAPSHOT_FAILED", metadata, err)
+	}
+
+	message, err := change(ctx)
+	if err != nil {
+		slog.Error("Failed to "+repo.Action, "component", component.Name, "err", err)
+		return nil, abortUpgrade(ctx, kubeCon, snapshots, "APPLY_FAILED", metadata, err)
+	}
+
+	sum := sha256.Sum256([]byte(repo.Manifest))
+	repo.Manifest_hash = hex.EncodeToString(sum[:])
+	repo.Previous = string(previous)
+	repo.Updated_at = time.Now().UTC()
+	repo.Cluster = kubeCon.Name()
+	if err := s.db.InsertRepo(&component.Table, repo); err != nil {
+		slog.Error("Failed to record "+repo.Action, "err", err)
+		return nil, abortUpgrade(ctx, kubeCon, snapshots, "RECORD_FAILED", metadata, err)
+	}
+	s.recordInventory(ctx, kubeCon.Name(), repo.Manifest, source, "")
+
+	return message, nil
+}
+
+// rollbackTarget finds the record to roll back to in repos, newest first:
+// the newest of toVersion, or of the version before the current one. It
+// returns the record's index and the live state of its version stored by the
+// upgrade that replaced it, for records without a manifest.
+func rollbackTarget(repos []controller.Repo, toVersion string) (int, []objectSnapshot, error) {
+	current := formatVersion(repos[0].Ver_major, repos[0].Ver_minor_1, repos[0].Ver_minor_2)
+	if toVersion == current {
+		return 0, nil, status.Errorf(codes.InvalidArgument, "%s is already at %s", repos[0].Repo_name, current)
+	}
+
+	found := false
+	for i := 1; i < len(repos); i++ {
+		version := formatVersion(repos[i].Ver_major, repos[i].Ver_minor_1, repos[i].Ver_minor_2)
+		if version == current || (toVersion != "" && version != toVersion) {
+			continue
+		}
+		found = true
+
+		if repos[i].Manifest != "" {
+			return i, nil, nil
+		}
+		if repos[i-1].Previous != "" {
+			var snapshots []objectSnapshot
+			if err := json.Unmarshal([]byte(repos[i-1].Previous), &snapshots); err != nil {
+				return 0, nil, fmt.Errorf("invalid live state stored with %s: %w", current, err)
+			}
+			return i, snapshots, nil
+		}
+		if toVersion == "" {
+			break
+		}
+	}
+
+	if !found {
+		if toVersion == "" {
+			return 0, nil, status.Errorf(codes.FailedPrecondition, "%s has no version before %s", repos[0].Repo_name, current)
+		}
+		return 0, nil, status.Errorf(codes.NotFound, "%s was never upgraded to %s", repos[0].Repo_name, toVersion)
+	}
+	return 0, nil, status.Errorf(codes.FailedPrecondition, "no manifest of the %s version to roll back to is stored", repos[0].Repo_name)
+}
+
+// RollbackUpgrade puts a component back to an earlier version by applying
+// its stored manifest, or by restoring the live state stored before the
+// upgrade that replaced it. The rollback is recorded as a new version.
+func (s *server) RollbackUpgrade(ctx context.Context, in *pb.RollbackUpgradeRequest) (*pb.RollbackUpgradeResponse, error) {
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to roll back upgrade", "err", err)
+		return nil, err
+	}
+
+	metadata := map[string]string{"version": in.ToVersion, "cluster": kubeCon.Name()}
+
+	component, err := s.component(in.Type)
+	if err != nil {
+		slog.Error("Failed to roll back upgrade", "err", err)
+		return nil, upgradeError(codes.InvalidArgument, "INVALID_TYPE", metadata, err)
+	}
+	metadata["component"] = component.Name
+
+	if in.ToVersion != "" {
+		if _, _, _, err := parseVersion(in.ToVersion); err != nil {
+			slog.Error("Failed to roll back upgrade", "err", err)
+			return nil, upgradeError(codes.InvalidArgument, "INVALID_VERSION", metadata, err)
+		}
+	}
+
+	if s.db == nil {
+		slog.Warn("Database is not available")
+		return nil, upgradeError(codes.FailedPrecondition, "DATABASE_UNAVAILABLE", metadata, fmt.Errorf("database is not available"))
+	}
+
+	var repos []controller.Repo
+	if err := s.db.GetRepos(&component.Table, &controller.RepoFilter{Clusters: s.repoClusters(kubeCon.Name())}, &repos); err != nil {
+		slog.Error("Failed to get upgrade history", "component", component.Name, "err", err)
+		return nil, err
+	}
+	if len(repos) == 0 {
+		err := fmt.Errorf("%s was never upgraded", component.Name)
+		slog.Error("Failed to roll back upgrade", "err", err)
+		return nil, upgradeError(codes.FailedPrecondition, "NO_ROLLBACK_TARGET", metadata, err)
+	}
+
+	index, snapshots, err := rollbackTarget(repos, in.ToVersion)
+	if err != nil {
+		slog.Error("Failed to roll back upgrade", "err", err)
+		return nil, upgradeError(status.Code(err), "NO_ROLLBACK_TARGET", metadata, err)
+	}
+	current, target := repos[0], repos[index]
+	fromVersion := formatVersion(current.Ver_major, current.Ver_minor_1, current.Ver_minor_2)
+	toVersion := formatVersion(target.Ver_major, target.Ver_minor_1, target.Ver_minor_2)
+	metadata["version"] = toVersion
+
+	repo := controller.Repo{
+		Repo_name:   component.Name,
+		Ver_major:   target.Ver_major,
+		Ver_minor_1: target.Ver_minor_1,
+		Ver_minor_2: target.Ver_minor_2,
+		Action:      "rollback",
+		Manifest:    target.Manifest,
+	}
+	objects := target.Manifest
+	restored, _ := getYamlObjects(target.Manifest)
+	change := func(ctx context.Context) (*string, error) {
+		return kubeCon.ApplyYaml(ctx, target.Manifest)
+	}
+	if snapshots != nil {
+		// the objects of the upgrade that replaced the target version
+		objects = repos[index-1].Manifest
+		var manifests, deleted []string
+		restored = nil
+		for _, snapshot := range snapshots {
+			restored = append(restored, snapshot.Object)
+			if snapshot.Manifest == "" {
+				deleted = append(deleted, snapshot.Object)
+				continue
+			}
+			manifests = append(manifests, snapshot.Manifest)
+		}
+		repo.Manifest = strings.Join(manifests, "---\n")
+		change = func(ctx context.Context) (*string, error) {
+			if err := restoreSnapshot(ctx, kubeCon, snapshots); err != nil {
+				return nil, err
+			}
+			s.forgetInventory(kubeCon.Name(), deleted)
+			message := fmt.Sprintf("restored %d objects, deleted %d", len(manifests), len(deleted))
+			return &message, nil
+		}
+	}
+
+	if err := s.checkYamlNamespace(ctx, objects); err != nil {
+		slog.Error("Failed to roll back upgrade", "err", err)
+		return nil, err
+	}
+
+	log.Printf("Rollback %s Ver %s to %s\n", component.Name, fromVersion, toVersion)
+	message, err := s.changeComponent(ctx, kubeCon, component, &repo, objects, "rollback from "+fromVersion, metadata, change)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("RollbackUpgradeResponse: %s", *message)
+
+	return &pb.RollbackUpgradeResponse{
+		Message:     *message,
+		FromVersion: fromVersion,
+		ToVersion:   toVersion,
+		Objects:     restored,
+	}, nil
+}
+
+// componentNamed returns the component with name, ignoring case, or the
+// component of an upgrade type number.
+func (s *server) componentNamed(name string) (*model.Component, error) {
+	if upgradeType, err := strconv.Atoi(name); err == nil {
+		return s.component(int32(upgradeType))
+	}
+
+	for i := range s.components {
+		if strings.EqualFold(s.components[i].Name, name) {
+			return &s.components[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown component %q", name)
+}
+
+// ListComponents returns the upgradable components in configuration order.
+func (s *server) ListComponents(ctx context.Context, in *pb.ListComponentsRequest) (*pb.ComponentList, error) {
+	var list pb.ComponentList
+	for _, component := range s.components {
+		list.Components = append(list.Components, &pb.Component{
+			Type:        component.Type,
+			Name:        component.Name,
+			Table:       component.Table,
+			Description: component.Description,
+			Deployments: component.Deployments,
+		})
+	}
+
+	log.Printf("ListComponentsResponse: %d components", len(list.Components))
+
+	return &list, nil
+}
+
+// repoClusters are the Cluster values of the version records of cluster.
+// Records of older servers have none and belong to the default cluster.
+func (s *server) repoClusters(cluster string) []string {
+	if cluster == s.defaultCluster {
+		return []string{cluster, ""}
+	}
+	return []string{cluster}
+}
+
+func (s *server) GetUpgradeHistory(ctx context.Context, in *pb.GetUpgradeHistoryRequest) (*pb.UpgradeHistory, error) {
+	if s.db == nil {
+		slog.Warn("Database is not available")
+		return nil, fmt.Errorf("database is not available")
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to get upgrade history", "err", err)
+		return nil, err
+	}
+
+	components := s.components
+	if in.Component != "" {
+		component, err := s.componentNamed(in.Component)
+		if err != nil {
+			slog.Error("Failed to get upgrade history", "err", err)
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		components = []model.Component{*component}
+	}
+
+	filter := controller.RepoFilter{
+		Clusters: s.repoClusters(kubeCon.Name()),
+		Limit:    int(in.Limit),
+	}
+	if in.Since != nil {
+		filter.Since = in.Since.AsTime()
+	}
+	if in.Until != nil {
+		filter.Until = in.Until.AsTime()
+	}
+
+	var history pb.UpgradeHistory
+	for _, component := range components {
+		var repos []controller.Repo
+		if err := s.db.GetRepos(&component.Table, &filter, &repos); err != nil {
+			slog.Error("Failed to get upgrade history", "component", component.Name, "err", err)
+			return nil, err
+		}
+
+		for _, repo := range repos {
+			record := &pb.UpgradeRecord{
+				Component:    component.Name,
+				Version:      formatVersion(repo.Ver_major, repo.Ver_minor_1, repo.Ver_minor_2),
+				Cluster:      kubeCon.Name(),
+				Action:       repo.Action,
+				ManifestHash: repo.Manifest_hash,
+			}
+			if !repo.Updated_at.IsZero() {
+				record.UpdatedAt = timestamppb.New(repo.Updated_at)
+			}
+			history.Records = append(history.Records, record)
+		}
+	}
+
+	// newest first across components, like each table
+	sort.SliceStable(history.Records, func(i, j int) bool {
+		return history.Records[i].UpdatedAt.AsTime().After(history.Records[j].UpdatedAt.AsTime())
+	})
+	if in.Limit > 0 && len(history.Records) > int(in.Limit) {
+		history.Records = history.Records[:in.Limit]
+	}
+
+	log.Printf("GetUpgradeHistoryResponse: %d records", len(history.Records))
+
+	return &history, nil
+}
+
+// GetComponentVersions returns the latest recorded version of every
+// component. Components never upgraded on the cluster get the version of their
+// running Deployments, without an update time, or an empty version.
+func (s *server) GetComponentVersions(ctx context.Context, in *pb.GetComponentVersionsRequest) (*pb.ComponentVersions, error) {
+	if s.db == nil {
+		slog.Warn("Database is not available")
+		return nil, fmt.Errorf("database is not available")
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to get component versions", "err", err)
+		return nil, err
+	}
+
+	filter := controller.RepoFilter{
+		Clusters: s.repoClusters(kubeCon.Name()),
+		Limit:    1,
+	}
+
+	versions := pb.ComponentVersions{Cluster: kubeCon.Name()}
+	for _, component := range s.components {
+		version := &pb.ComponentVersion{Name: component.Name}
+
+		var repos []controller.Repo
+		if err := s.db.GetRepos(&component.Table, &filter, &repos); err != nil {
+			slog.Error("Failed to get version", "component", component.Name, "err", err)
+			return nil, err
+		}
+		if len(repos) > 0 {
+			version.Version = formatVersion(repos[0].Ver_major, repos[0].Ver_minor_1, repos[0].Ver_minor_2)
+			if !repos[0].Updated_at.IsZero() {
+				version.UpdatedAt = timestamppb.New(repos[0].Updated_at)
+			}
+		} else {
+			version.Version = deployedVersion(ctx, kubeCon, &component)
+		}
+		versions.Components = append(versions.Components, version)
+	}
+
+	log.Printf("GetComponentVersionsResponse: %d components", len(versions.Components))
+
+	return &versions, nil
+}
+
+// deployedVersion returns the version in the image tag of the first container
+// of component's Deployments that has one, or "" when none is running.
+func deployedVersion(ctx context.Context, backend Backend, component *model.Component) string {
+	for _, deployment := range component.Deployments {
+		namespace, name, _ := strings.Cut(deployment, "/")
+		live, err := backend.GetObjects(ctx, "Deployment", namespace, name, "")
+		if err != nil {
+			slog.Error("Failed to get deployment", "deployment", deployment, "component", component.Name, "err", err)
+			continue
+		}
+		if len(live) == 0 {
+			continue
+		}
+
+		containers, _, _ := unstructured.NestedSlice(live[0], "spec", "template", "spec", "containers")
+		for _, container := range containers {
+			fields, _ := container.(map[string]interface{})
+			image, _, _ := unstructured.NestedString(fields, "image")
+			// the tag follows the last ":" after the registry and path
+			image, _, _ = strings.Cut(image[strings.LastIndex(image, "/")+1:], "@")
+			if _, tag, ok := strings.Cut(image, ":"); ok {
+				if major, minor1, minor2, err := parseVersion(tag); err == nil {
+					return formatVersion(major, minor1, minor2)
+				}
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,453 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"com.kubebackend/m/client/controller"
+	pb "com.kubebackend/m/proto"
+	"com.kubebackend/m/server/model"
+)
+
+const testNavigationService = `apiVersion: v1
+kind: Service
+metadata:
+  name: navigation
+  namespace: robot
+`
+
+func newUpgradeServer(t *testing.T) (*server, *KubeController) {
+	t.Helper()
+
+	backend := NewFakeKubeController("sim-01")
+	config := &model.Config{
+		Database:   filepath.Join(t.TempDir(), "test.db"),
+		Components: []model.Component{{Name: "NAVIGATION", Table: "navigations"}},
+	}
+	s, err := NewServerWithBackends(config, []Backend{backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+
+	return s, backend
+}
+
+// upgradeErrorInfo returns the ErrorInfo of an UpgradeYaml error.
+func upgradeErrorInfo(t *testing.T, err error) *errdetails.ErrorInfo {
+	t.Helper()
+
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == UpgradeErrorDomain {
+			return info
+		}
+	}
+	t.Fatalf("error %v has no upgrade ErrorInfo", err)
+	return nil
+}
+
+func deploymentImage(t *testing.T, backend *KubeController) string {
+	t.Helper()
+
+	deployment, err := backend.Clientset.AppsV1().Deployments("robot").Get(context.Background(), "navigation", metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return ""
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return deployment.Spec.Template.Spec.Containers[0].Image
+}
+
+func TestUpgradeYaml(t *testing.T) {
+	s, backend := newUpgradeServer(t)
+	ctx := context.Background()
+
+	before := time.Now().UTC().Add(-time.Second)
+	if _, err := s.UpgradeYaml(ctx, &pb.UpgradeYamlRequest{Yaml: testDeployment, Version: "24.12.3", Type: 0}); err != nil {
+		t.Fatalf("UpgradeYaml: %v", err)
+	}
+	if image := deploymentImage(t, backend); image != "registry.local/navigation:24.12.3" {
+		t.Errorf("image = %q, want the upgrade applied", image)
+	}
+
+	table := "navigations"
+	var repo controller.Repo
+	if err := s.db.GetLatestRepo(&table, &repo); err != nil {
+		t.Fatalf("no version recorded: %v", err)
+	}
+	if formatVersion(repo.Ver_major, repo.Ver_minor_1, repo.Ver_minor_2) != "24.12.3" || repo.Updated_at.Before(before) {
+		t.Errorf("recorded %+v, want 24.12.3 updated now", repo)
+	}
+}
+
+func TestUpgradeYamlInvalid(t *testing.T) {
+	s, backend := newUpgradeServer(t)
+
+	tests := []struct {
+		name    string
+		request *pb.UpgradeYamlRequest
+		reason  string
+	}{
+		{"version", &pb.UpgradeYamlRequest{Yaml: testDeployment, Version: "24.12", Type: 0}, "INVALID_VERSION"},
+		{"version number", &pb.UpgradeYamlRequest{Yaml: testDeployment, Version: "24.x.3", Type: 0}, "INVALID_VERSION"},
+		{"type", &pb.UpgradeYamlRequest{Yaml: testDeployment, Version: "24.12.3", Type: 7}, "INVALID_TYPE"},
+		{"kind", &pb.UpgradeYamlRequest{Yaml: testDeployment + "---\nkind: Secret\nmetadata:\n  name: token\n  namespace: robot\n", Version: "24.12.3", Type: 0}, "SNAPSHOT_FAILED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UpgradeYaml(context.Background(), tt.request)
+			if code := status.Code(err); code != codes.InvalidArgument && code != codes.FailedPrecondition {
+				t.Errorf("code = %v, want InvalidArgument or FailedPrecondition", code)
+			}
+			if info := upgradeErrorInfo(t, err); info.Reason != tt.reason || info.Metadata["restored"] != "" {
+				t.Errorf("error info = %v, want %s before any change", info, tt.reason)
+			}
+			if image := deploymentImage(t, backend); image != "" {
+				t.Errorf("invalid upgrade applied %s", image)
+			}
+		})
+	}
+
+	table := "navigations"
+	var repos []controller.Repo
+	s.db.GetAllRepos(&table, &repos)
+	if len(repos) != 0 {
+		t.Errorf("invalid upgrades recorded %v", repos)
+	}
+}
+
+func TestUpgradeYamlRestore(t *testing.T) {
+	s, backend := newUpgradeServer(t)
+	ctx := context.Background()
+
+	if _, err := s.UpgradeYaml(ctx, &pb.UpgradeYamlRequest{Yaml: testDeployment, Version: "24.12.3", Type: 0}); err != nil {
+		t.Fatalf("UpgradeYaml: %v", err)
+	}
+
+	// the service is created after the deployment is updated, and fails
+	backend.Clientset.(*fake.Clientset).PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("admission webhook denied the request")
+	})
+
+	upgrade := strings.Replace(testDeployment, "24.12.3", "24.12.4", 1) + "---\n" + testNavigationService
+	_, err := s.UpgradeYaml(ctx, &pb.UpgradeYamlRequest{Yaml: upgrade, Version: "24.12.4", Type: 0})
+	if status.Code(err) != codes.Aborted || !strings.Contains(err.Error(), "admission webhook denied") {
+		t.Fatalf("UpgradeYaml error = %v, want Aborted with the apply error", err)
+	}
+	info := upgradeErrorInfo(t, err)
+	if info.Reason != "APPLY_FAILED" || info.Metadata["restored"] != "true" || info.Metadata["component"] != "NAVIGATION" {
+		t.Errorf("error info = %v", info)
+	}
+
+	if image := deploymentImage(t, backend); image != "registry.local/navigation:24.12.3" {
+		t.Errorf("image after restore = %s, want 24.12.3", image)
+	}
+
+	table := "navigations"
+	var repo controller.Repo
+	s.db.GetLatestRepo(&table, &repo)
+	if formatVersion(repo.Ver_major, repo.Ver_minor_1, repo.Ver_minor_2) != "24.12.3" {
+		t.Errorf("latest version = %+v, want the failed upgrade unrecorded", repo)
+	}
+}
+
+func TestRestoreSnapshotDeletesNewObjects(t *testing.T) {
+	backend := NewFakeKubeController("sim-01")
+	ctx := context.Background()
+
+	snapshots, err := snapshotObjects(ctx, backend, testDeployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.ApplyYaml(ctx, testDeployment); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := restoreSnapshot(ctx, backend, snapshots); err != nil {
+		t.Fatalf("restoreSnapshot: %v", err)
+	}
+	if image := deploymentImage(t, backend); image != "" {
+		t.Errorf("deployment created by the upgrade was kept with %s", image)
+	}
+}
+
+func TestGetUpgradeHistory(t *testing.T) {
+	config := &model.Config{
+		Database: filepath.Join(t.TempDir(), "test.db"),
+		Components: []model.Component{
+			{Type: 0, Name: "NAVIGATION", Table: "navigations"},
+			{Type: 1, Name: "MIDDLEWARE", Table: "middlewares"},
+		},
+	}
+	s, err := NewServerWithBackends(config, []Backend{NewFakeKubeController("sim-01"), NewFakeKubeController("sim-02")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	upgrades := []struct {
+		cluster       string
+		upgradeType   int32
+		version, yaml string
+	}{
+		{"sim-01", 0, "24.12.1", testDeployment},
+		{"sim-01", 1, "24.11.0", testNavigationService},
+		{"sim-01", 0, "24.12.3", testDeployment},
+		{"sim-02", 0, "24.12.2", testDeployment},
+	}
+	for _, upgrade := range upgrades {
+		request := &pb.UpgradeYamlRequest{Cluster: upgrade.cluster, Yaml: upgrade.yaml, Version: upgrade.version, Type: upgrade.upgradeType}
+		if _, err := s.UpgradeYaml(ctx, request); err != nil {
+			t.Fatalf("UpgradeYaml %v: %v", upgrade, err)
+		}
+	}
+
+	versions := func(request *pb.GetUpgradeHistoryRequest) []string {
+		t.Helper()
+		history, err := s.GetUpgradeHistory(ctx, request)
+		if err != nil {
+			t.Fatalf("GetUpgradeHistory: %v", err)
+		}
+		var got []string
+		for _, record := range history.Records {
+			if record.UpdatedAt == nil {
+				t.Errorf("record %v has no time", record)
+			}
+			got = append(got, record.Component+" "+record.Version)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name    string
+		request *pb.GetUpgradeHistoryRequest
+		want    []string
+	}{
+		{"cluster", &pb.GetUpgradeHistoryRequest{}, []string{"NAVIGATION 24.12.3", "MIDDLEWARE 24.11.0", "NAVIGATION 24.12.1"}},
+		{"other cluster", &pb.GetUpgradeHistoryRequest{Cluster: "sim-02"}, []string{"NAVIGATION 24.12.2"}},
+		{"component name", &pb.GetUpgradeHistoryRequest{Component: "navigation"}, []string{"NAVIGATION 24.12.3", "NAVIGATION 24.12.1"}},
+		{"component type", &pb.GetUpgradeHistoryRequest{Component: "1"}, []string{"MIDDLEWARE 24.11.0"}},
+		{"limit", &pb.GetUpgradeHistoryRequest{Limit: 2}, []string{"NAVIGATION 24.12.3", "MIDDLEWARE 24.11.0"}},
+		{"until", &pb.GetUpgradeHistoryRequest{Until: timestamppb.New(time.Now().Add(-time.Hour))}, nil},
+		{"since", &pb.GetUpgradeHistoryRequest{Since: timestamppb.New(time.Now().Add(-time.Hour))}, []string{"NAVIGATION 24.12.3", "MIDDLEWARE 24.11.0", "NAVIGATION 24.12.1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := versions(tt.request); !slices.Equal(got, tt.want) {
+				t.Errorf("history = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.GetUpgradeHistory(ctx, &pb.GetUpgradeHistoryRequest{Component: "lidar"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("unknown component error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestGetComponentVersions(t *testing.T) {
+	config := &model.Config{
+		Database: filepath.Join(t.TempDir(), "test.db"),
+		Components: []model.Component{
+			{Type: 0, Name: "NAVIGATION", Table: "navigations"},
+			{Type: 1, Name: "MIDDLEWARE", Table: "middlewares", Deployments: []string{"robot/middleware"}},
+		},
+	}
+	s, err := NewServerWithBackends(config, []Backend{NewFakeKubeController("sim-01"), NewFakeKubeController("sim-02")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	for _, upgrade := range []*pb.UpgradeYamlRequest{
+		{Cluster: "sim-01", Yaml: testDeployment, Version: "24.12.1"},
+		{Cluster: "sim-01", Yaml: testDeployment, Version: "24.12.3"},
+		{Cluster: "sim-02", Yaml: testDeployment, Version: "24.12.2"},
+	} {
+		if _, err := s.UpgradeYaml(ctx, upgrade); err != nil {
+			t.Fatalf("UpgradeYaml: %v", err)
+		}
+	}
+	// middleware runs on sim-02 without being upgraded by the server
+	middleware := strings.NewReplacer("navigation", "middleware", "24.12.3", "1.0.2").Replace(testDeployment)
+	if _, err := s.ApplyYaml(ctx, &pb.ApplyYamlRequest{Cluster: "sim-02", Yaml: middleware}); err != nil {
+		t.Fatalf("ApplyYaml: %v", err)
+	}
+
+	tests := []struct {
+		cluster string
+		want    []string
+	}{
+		{"", []string{"NAVIGATION 24.12.3", "MIDDLEWARE "}},
+		{"sim-02", []string{"NAVIGATION 24.12.2", "MIDDLEWARE 1.0.2"}},
+	}
+	for _, tt := range tests {
+		versions, err := s.GetComponentVersions(ctx, &pb.GetComponentVersionsRequest{Cluster: tt.cluster})
+		if err != nil {
+			t.Fatalf("GetComponentVersions: %v", err)
+		}
+
+		var got []string
+		for _, component := range versions.Components {
+			got = append(got, component.Name+" "+component.Version)
+			// only recorded versions have an update time
+			if (component.Name == "NAVIGATION") != (component.UpdatedAt != nil) {
+				t.Errorf("%s: updatedAt = %v for version %q", tt.cluster, component.UpdatedAt, component.Version)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: versions = %v, want %v", tt.cluster, got, tt.want)
+		}
+	}
+}
+
+func navigationRelease(version string) string {
+	return strings.Replace(testDeployment, "navigation:24.12.3", "navigation:"+version, 1)
+}
+
+func TestRollbackUpgrade(t *testing.T) {
+	s, backend := newUpgradeServer(t)
+	ctx := context.Background()
+
+	if _, err := s.RollbackUpgrade(ctx, &pb.RollbackUpgradeRequest{}); status.Code(err) != codes.FailedPrecondition || upgradeErrorInfo(t, err).Reason != "NO_ROLLBACK_TARGET" {
+		t.Errorf("rollback before any upgrade = %v, want NO_ROLLBACK_TARGET", err)
+	}
+
+	for _, version := range []string{"24.12.1", "24.12.2", "24.12.3"} {
+		if _, err := s.UpgradeYaml(ctx, &pb.UpgradeYamlRequest{Yaml: navigationRelease(version), Version: version}); err != nil {
+			t.Fatalf("UpgradeYaml %s: %v", version, err)
+		}
+	}
+
+	resp, err := s.RollbackUpgrade(ctx, &pb.RollbackUpgradeRequest{})
+	if err != nil {
+		t.Fatalf("RollbackUpgrade: %v", err)
+	}
+	if resp.FromVersion != "24.12.3" || resp.ToVersion != "24.12.2" {
+		t.Errorf("rolled back from %s to %s, want 24.12.3 to 24.12.2", resp.FromVersion, resp.ToVersion)
+	}
+	if image := deploymentImage(t, backend); image != "registry.local/navigation:24.12.2" {
+		t.Errorf("image = %q, want 24.12.2 applied again", image)
+	}
+
+	table := "navigations"
+	var repo controller.Repo
+	if err := s.db.GetLatestRepo(&table, &repo); err != nil {
+		t.Fatal(err)
+	}
+	if repo.Action != "rollback" || formatVersion(repo.Ver_major, repo.Ver_minor_1, repo.Ver_minor_2) != "24.12.2" || repo.Manifest != navigationRelease("24.12.2") || repo.Manifest_hash == "" {
+		t.Errorf("recorded %+v, want a rollback to 24.12.2 with its manifest", repo)
+	}
+
+	if _, err := s.RollbackUpgrade(ctx, &pb.RollbackUpgradeRequest{ToVersion: "24.12.1"}); err != nil {
+		t.Fatalf("RollbackUpgrade to 24.12.1: %v", err)
+	}
+	if image := deploymentImage(t, backend); image != "registry.local/navigation:24.12.1" {
+		t.Errorf("image = %q, want 24.12.1", image)
+	}
+
+	tests := []struct {
+		toVersion string
+		code      codes.Code
+		reason    string
+	}{
+		{"24.12.1", codes.InvalidArgument, "NO_ROLLBACK_TARGET"},
+		{"23.1.0", codes.NotFound, "NO_ROLLBACK_TARGET"},
+		{"24.12", codes.InvalidArgument, "INVALID_VERSION"},
+	}
+	for _, tt := range tests {
+		_, err := s.RollbackUpgrade(ctx, &pb.RollbackUpgradeRequest{ToVersion: tt.toVersion})
+		if status.Code(err) != tt.code || upgradeErrorInfo(t, err).Reason != tt.reason {
+			t.Errorf("rollback to %s = %v, want %s %s", tt.toVersion, err, tt.code, tt.reason)
+		}
+	}
+}
+
+func TestRollbackUpgradeToLiveState(t *testing.T) {
+	s, backend := newUpgradeServer(t)
+	ctx := context.Background()
+
+	// 24.11.0 was upgraded by an older server, which stored no manifest
+	if _, err := backend.ApplyYaml(ctx, navigationRelease("24.11.0")); err != nil {
+		t.Fatal(err)
+	}
+	table := "navigations"
+	if err := s.db.InsertRepo(&table, &controller.Repo{Repo_name: "NAVIGATION", Ver_major: 24, Ver_minor_1: 11}); err != nil {
+		t.Fatal(err)
+	}
+
+	upgrade := navigationRelease("24.12.0") + "---\n" + testNavigationService
+	if _, err := s.UpgradeYaml(ctx, &pb.UpgradeYamlRequest{Yaml: upgrade, Version: "24.12.0"}); err != nil {
+		t.Fatalf("UpgradeYaml: %v", err)
+	}
+
+	resp, err := s.RollbackUpgrade(ctx, &pb.RollbackUpgradeRequest{})
+	if err != nil {
+		t.Fatalf("RollbackUpgrade: %v", err)
+	}
+	if resp.ToVersion != "24.11.0" {
+		t.Errorf("rolled back to %s, want 24.11.0", resp.ToVersion)
+	}
+	if image := deploymentImage(t, backend); image != "registry.local/navigation:24.11.0" {
+		t.Errorf("image = %q, want the live state before 24.12.0", image)
+	}
+	if _, err := backend.Clientset.CoreV1().Services("robot").Get(ctx, "navigation", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("service created by 24.12.0 = %v, want deleted", err)
+	}
+}
+
+func TestListComponents(t *testing.T) {
+	config := &model.Config{
+		Database: filepath.Join(t.TempDir(), "test.db"),
+		Components: []model.Component{
+			{Type: 3, Name: "NAVIGATION", Table: "navigations", Description: "Navigation", Deployments: []string{"robot/navigation"}},
+			{Type: 2, Name: "MIDDLEWARE", Table: "middlewares"},
+		},
+	}
+	s, err := NewServerWithBackends(config, []Backend{NewFakeKubeController("sim-01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	list, err := s.ListComponents(context.Background(), &pb.ListComponentsRequest{})
+	if err != nil {
+		t.Fatalf("ListComponents: %v", err)
+	}
+
+	var got []string
+	for _, component := range list.Components {
+		got = append(got, fmt.Sprintf("%d %s %s %s %v", component.Type, component.Name, component.Table, component.Description, component.Deployments))
+	}
+	want := []string{"3 NAVIGATION navigations Navigation [robot/navigation]", "2 MIDDLEWARE middlewares  []"}
+	if !slices.Equal(got, want) {
+		t.Errorf("components = %q, want %q", got, want)
+	}
+
+	// numbers select the configured type, not the position
+	for name, want := range map[string]string{"3": "NAVIGATION", "2": "MIDDLEWARE", "middleware": "MIDDLEWARE"} {
+		if component, err := s.componentNamed(name); err != nil || component.Name != want {
+			t.Errorf("componentNamed(%q) = %v, %v, want %s", name, component, err, want)
+		}
+	}
+	if _, err := s.componentNamed("0"); err == nil {
+		t.Error("componentNamed(0) found a component without that type")
+	}
+}
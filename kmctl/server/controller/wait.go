@@ -0,0 +1,302 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/jsonpath"
+
+	pb "com.kubebackend/m/proto"
+)
+
+// WaitPollInterval is how often Wait checks the objects it waits for.
+var WaitPollInterval = time.Second
+
+// waitKinds maps the kind names Wait accepts to the kinds GetObjects knows.
+var waitKinds = map[string]string{
+	"pod":         "Pod",
+	"pods":        "Pod",
+	"po":          "Pod",
+	"deployment":  "Deployment",
+	"deployments": "Deployment",
+	"deploy":      "Deployment",
+	"service":     "Service",
+	"services":    "Service",
+	"svc":         "Service",
+	"node":        "Node",
+	"nodes":       "Node",
+	"no":          "Node",
+}
+
+// waitCondition is a parsed "delete", "condition=Type[=Status]" or
+// "jsonpath={path}[=value]".
+type waitCondition struct {
+	delete bool
+	// conditionType is the status condition to check, or empty for a jsonpath
+	conditionType string
+	path          *jsonpath.JSONPath
+	// value is the wanted status or jsonpath value, empty when any value of
+	// the jsonpath will do
+	value string
+}
+
+func parseWaitCondition(condition string) (*waitCondition, error) {
+	switch {
+	case condition == "delete":
+		return &waitCondition{delete: true}, nil
+	case strings.HasPrefix(condition, "condition="):
+		conditionType, value, _ := strings.Cut(strings.TrimPrefix(condition, "condition="), "=")
+		if conditionType == "" {
+			return nil, fmt.Errorf("condition %q has no type", condition)
+		}
+		if value == "" {
+			value = "True"
+		}
+		return &waitCondition{conditionType: conditionType, value: value}, nil
+	case strings.HasPrefix(condition, "jsonpath="):
+		expression := strings.TrimPrefix(condition, "jsonpath=")
+		var value string
+		if strings.HasPrefix(expression, "{") {
+			end := strings.LastIndex(expression, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q is not closed", expression)
+			}
+			expression, value = expression[:end+1], strings.TrimPrefix(expression[end+1:], "=")
+		} else {
+			expression, value, _ = strings.Cut(expression, "=")
+			expression = "{" + expression + "}"
+		}
+
+		path := jsonpath.New("wait")
+		if err := path.Parse(expression); err != nil {
+			return nil, fmt.Errorf("invalid jsonpath %q: %w", expression, err)
+		}
+		return &waitCondition{path: path, value: value}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported condition %q, want delete, condition=<type>[=<status>] or jsonpath={<path>}[=<value>]", condition)
+}
+
+// check reports whether objects meet the condition, and their state.
+func (w *waitCondition) check(objects []map[string]interface{}) (bool, string) {
+	if w.delete {
+		if len(objects) == 0 {
+			return true, "deleted"
+		}
+		return false, fmt.Sprintf("%d objects remain", len(objects))
+	}
+	if len(objects) == 0 {
+		return false, "not found"
+	}
+
+	met := true
+	states := make([]string, 0, len(objects))
+	for _, object := range objects {
+		ok, state := w.checkObject(object)
+		met = met && ok
+		metadata, _ := object["metadata"].(map[string]interface{})
+		states = append(states, fmt.Sprintf("%v: %s", metadata["name"], state))
+	}
+
+	return met, strings.Join(states, ", ")
+}
+
+func (w *waitCondition) checkObject(object map[string]interface{}) (bool, string) {
+	if w.path != nil {
+		results, err := w.path.FindResults(object)
+		if err != nil || len(results) == 0 || len(results[0]) == 0 {
+			return false, "no value"
+		}
+
+		var buf bytes.Buffer
+		if err := w.path.PrintResults(&buf, results[0]); err != nil {
+			return false, err.Error()
+		}
+		value := buf.String()
+		return w.value == "" || value == w.value, value
+	}
+
+	objectStatus, _ := object["status"].(map[string]interface{})
+	conditions, _ := objectStatus["conditions"].([]interface{})
+	for _, item := range conditions {
+		condition, _ := item.(map[string]interface{})
+		conditionType, _ := condition["type"].(string)
+		if !strings.EqualFold(conditionType, w.conditionType) {
+			continue
+		}
+		conditionStatus, _ := condition["status"].(string)
+		return strings.EqualFold(conditionStatus, w.value), conditionType + "=" + conditionStatus
+	}
+
+	return false, "no " + w.conditionType + " condition"
+}
+
+// GetObjects returns the objects of kind named name, or matching selector
+// when name is empty, as unstructured content. A missing named object gives
+// no objects.
+func (k *KubeController) GetObjects(ctx context.Context, kind, namespace, name, selector string) ([]map[string]interface{}, error) {
+	var items []runtime.Object
+	var err error
+	listOptions := metav1.ListOptions{LabelSelector: selector}
+
+	switch kind {
+	case "Pod":
+		if name != "" {
+			var pod runtime.Object
+			pod, err = k.Clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+			items = append(items, pod)
+		} else {
+			pods, listErr := k.Clientset.CoreV1().Pods(namespace).List(ctx, listOptions)
+			if listErr != nil {
+				return nil, listErr
+			}
+			for i := range pods.Items {
+				items = append(items, &pods.Items[i])
+			}
+		}
+	case "Deployment":
+		if name != "" {
+			var deployment runtime.Object
+			deployment, err = k.Clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			items = append(items, deployment)
+		} else {
+			deployments, listErr := k.Clientset.AppsV1().Deployments(namespace).List(ctx, listOptions)
+			if listErr != nil {
+				return nil, listErr
+			}
+			for i := range deployments.Items {
+				items = append(items, &deployments.Items[i])
+			}
+		}
+	case "Service":
+		if name != "" {
+			var service runtime.Object
+			service, err = k.Clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+			items = append(items, service)
+		} else {
+			services, listErr := k.Clientset.CoreV1().Services(namespace).List(ctx, listOptions)
+			if listErr != nil {
+				return nil, listErr
+			}
+			for i := range services.Items {
+				items = append(items, &services.Items[i])
+			}
+		}
+	case "Node":
+		if name != "" {
+			var node runtime.Object
+			node, err = k.Clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			items = append(items, node)
+		} else {
+			nodes, listErr := k.Clientset.CoreV1().Nodes().List(ctx, listOptions)
+			if listErr != nil {
+				return nil, listErr
+			}
+			for i := range nodes.Items {
+				items = append(items, &nodes.Items[i])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", kind)
+	}
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	objects := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(item)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, nil
+}
+
+func (s *server) Wait(in *pb.WaitRequest, stream pb.KubeBackend_WaitServer) error {
+	condition, err := parseWaitCondition(in.Condition)
+	if err != nil {
+		slog.Error("Failed to wait", "err", err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	kind, ok := waitKinds[strings.ToLower(in.Kind)]
+	if !ok {
+		slog.Error("Failed to wait: unsupported kind", "kind", in.Kind)
+		return status.Errorf(codes.InvalidArgument, "unsupported kind %q, want pod, deployment, service or node", in.Kind)
+	}
+	if (in.Name == "") == (in.Selector == "") {
+		slog.Error("Failed to wait: want a name or a selector")
+		return status.Error(codes.InvalidArgument, "wait needs either a name or a selector")
+	}
+
+	namespace := in.Namespace
+	if kind == "Node" {
+		namespace = ""
+	} else if err := s.checkNamespace(stream.Context(), namespace); err != nil {
+		slog.Error("Failed to wait", "err", err)
+		return err
+	}
+
+	kubeCon, err := s.cluster(in.Cluster)
+	if err != nil {
+		slog.Error("Failed to wait", "err", err)
+		return err
+	}
+
+	ctx, cancel := s.streamContext(stream.Context())
+	defer cancel()
+
+	ticker := time.NewTicker(WaitPollInterval)
+	defer ticker.Stop()
+
+	last := ""
+	for {
+		objects, err := kubeCon.GetObjects(ctx, kind, namespace, in.Name, in.Selector)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to wait", "err", err)
+			return streamError(ctx, err)
+		}
+
+		if err == nil {
+			met, state := condition.check(objects)
+			if met || state != last {
+				if err := stream.Send(&pb.WaitEvent{
+					Met:   met,
+					State: state,
+					Time:  timestamppb.Now(),
+				}); err != nil {
+					slog.Error("Failed to send wait event", "err", err)
+					return err
+				}
+				last = state
+			}
+			if met {
+				log.Printf("WaitResponse: %s %s%s met %s", kind, in.Name, in.Selector, in.Condition)
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Error("Failed to wait", "kind", kind, "name", in.Name, "selector", in.Selector, "err", ctx.Err())
+			return streamError(ctx, status.FromContextError(ctx.Err()).Err())
+		case <-ticker.C:
+		}
+	}
+}
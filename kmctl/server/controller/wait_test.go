@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWaitCondition(t *testing.T) {
+	ready := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "navigation-0", Namespace: "robot", Labels: map[string]string{"app": "navigation"}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+		},
+	}
+	pending := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "navigation-1", Namespace: "robot", Labels: map[string]string{"app": "navigation"}},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodPending,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionFalse}},
+		},
+	}
+	backend := NewFakeKubeController("sim-01", ready, pending)
+
+	tests := []struct {
+		condition string
+		name      string
+		selector  string
+		met       bool
+		state     string
+	}{
+		{"condition=Ready", "navigation-0", "", true, "navigation-0: Ready=True"},
+		{"condition=ready=false", "navigation-1", "", true, "navigation-1: Ready=False"},
+		{"condition=Ready", "", "app=navigation", false, "navigation-0: Ready=True, navigation-1: Ready=False"},
+		{"condition=Initialized", "navigation-0", "", false, "navigation-0: no Initialized condition"},
+		{"jsonpath={.status.phase}=Running", "navigation-0", "", true, "navigation-0: Running"},
+		{"jsonpath=.status.phase=Running", "navigation-1", "", false, "navigation-1: Pending"},
+		{"jsonpath={.status.podIP}", "navigation-0", "", false, "navigation-0: no value"},
+		{"condition=Ready", "gone", "", false, "not found"},
+		{"delete", "gone", "", true, "deleted"},
+		{"delete", "", "app=navigation", false, "2 objects remain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.condition+" "+tt.name+tt.selector, func(t *testing.T) {
+			condition, err := parseWaitCondition(tt.condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			objects, err := backend.GetObjects(context.Background(), "Pod", "robot", tt.name, tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			met, state := condition.check(objects)
+			if met != tt.met || state != tt.state {
+				t.Errorf("check = %v %q, want %v %q", met, state, tt.met, tt.state)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", "Ready", "condition=", "jsonpath={.status", "jsonpath={.status.phase"} {
+		if _, err := parseWaitCondition(invalid); err == nil {
+			t.Errorf("parseWaitCondition(%q) succeeded", invalid)
+		}
+	}
+}
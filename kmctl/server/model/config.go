@@ -0,0 +1,90 @@
+package model
+
+import "time"
+
+// Config is the server configuration. It is read from the config file,
+// overridden by KUBE_BACKEND_* environment variables and then by flags.
+type Config struct {
+	Listen         Listen        `mapstructure:"listen" yaml:"listen"`
+	Kubeconfig     string        `mapstructure:"kubeconfig" yaml:"kubeconfig"`
+	Context        string        `mapstructure:"context" yaml:"context"`
+	Contexts       []string      `mapstructure:"contexts" yaml:"contexts"`
+	Database       string        `mapstructure:"database" yaml:"database"`
+	HealthInterval time.Duration `mapstructure:"healthInterval" yaml:"healthInterval"`
+	DrainTimeout   time.Duration `mapstructure:"drainTimeout" yaml:"drainTimeout"`
+	TLS            TLS           `mapstructure:"tls" yaml:"tls"`
+	Auth           Auth          `mapstructure:"auth" yaml:"auth"`
+	Namespaces     []string      `mapstructure:"namespaces" yaml:"namespaces"`
+	Components     []Component   `mapstructure:"components" yaml:"components"`
+	LogLevel       string        `mapstructure:"logLevel" yaml:"logLevel"`
+	Features       Features      `mapstructure:"features" yaml:"features"`
+	Fake           Fake          `mapstructure:"fake" yaml:"fake"`
+}
+
+type Listen struct {
+	Host        string `mapstructure:"host" yaml:"host"`
+	Port        string `mapstructure:"port" yaml:"port"`
+	HealthPort  string `mapstructure:"healthPort" yaml:"healthPort"`
+	MetricsPort string `mapstructure:"metricsPort" yaml:"metricsPort"`
+	HTTPPort    string `mapstructure:"httpPort" yaml:"httpPort"`
+}
+
+type TLS struct {
+	Cert     string `mapstructure:"cert" yaml:"cert"`
+	Key      string `mapstructure:"key" yaml:"key"`
+	ClientCA string `mapstructure:"clientCA" yaml:"clientCA"`
+}
+
+type Auth struct {
+	TokenFile     string `mapstructure:"tokenFile" yaml:"tokenFile"`
+	JWTSecretFile string `mapstructure:"jwtSecretFile" yaml:"jwtSecretFile"`
+}
+
+// Component is an upgradable robot component. Type is the number upgrade -t
+// selects it by, and its version records are kept in its own database table.
+// Deployments are the "namespace/name" of the Deployments it ships, whose
+// image tags give its version on clusters without version records.
+type Component struct {
+	Type        int32    `mapstructure:"type" yaml:"type"`
+	Name        string   `mapstructure:"name" yaml:"name"`
+	Table       string   `mapstructure:"table" yaml:"table"`
+	Description string   `mapstructure:"description" yaml:"description"`
+	Deployments []string `mapstructure:"deployments" yaml:"deployments"`
+}
+
+type Features struct {
+	Reflection bool `mapstructure:"reflection" yaml:"reflection"`
+	Audit      bool `mapstructure:"audit" yaml:"audit"`
+	Informers  bool `mapstructure:"informers" yaml:"informers"`
+	Dashboard  bool `mapstructure:"dashboard" yaml:"dashboard"`
+}
+
+// Fake configures the simulation mode, which serves in-memory clusters seeded
+// from fixture files instead of real ones.
+type Fake struct {
+	Enabled     bool          `mapstructure:"enabled" yaml:"enabled"`
+	Fixtures    string        `mapstructure:"fixtures" yaml:"fixtures"`
+	Robots      int           `mapstructure:"robots" yaml:"robots"`
+	Tick        time.Duration `mapstructure:"tick" yaml:"tick"`
+	FailureRate float64       `mapstructure:"failureRate" yaml:"failureRate"`
+}
+
+// AllowsNamespace reports whether the server may operate on namespace. An
+// empty list allows every namespace, "" asks for all namespaces at once.
+func (c *Config) AllowsNamespace(namespace string) bool {
+	return NamespaceAllowed(c.Namespaces, namespace)
+}
+
+// NamespaceAllowed reports whether namespace is in allowed. An empty list or
+// "*" allows everything; the empty namespace (all namespaces) needs either.
+func NamespaceAllowed(allowed []string, namespace string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, ns := range allowed {
+		if ns == "*" || (namespace != "" && ns == namespace) {
+			return true
+		}
+	}
+	return false
+}